@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localConfig is the configuration file of the current
+// directory, its values override the global ones.
+const localConfig = ".tracker.json"
+
+var ErrNoHome = errors.New("home directory not found, set HOME or --dir.")
+
+type ErrConfigKey struct {
+	key string
+}
+
+func (err *ErrConfigKey) Error() string {
+	names := make([]string, len(configKeys))
+	for i, k := range configKeys {
+		names[i] = k.name
+	}
+	return fmt.Sprintf("unknown config key %q, expected %s.", err.key, strings.Join(names, ", "))
+}
+
+type ErrConfigValue struct {
+	key, value, expected string
+}
+
+func (err *ErrConfigValue) Error() string {
+	return fmt.Sprintf("invalid %s %q, expected %s.", err.key, err.value, err.expected)
+}
+
+// Config holds the defaults of the commands by key,
+// it is stored as a json object.
+type Config map[string]string
+
+type configKey struct {
+	name  string
+	usage string
+	check func(string) bool
+}
+
+var configKeys = []configKey{
+	{"dir", "directory of the trackers", nil},
+	{"tracker", "tracker of the commands", nil},
+	{"category", "category id or name of last and add", nil},
+	periodKey("last"),
+	periodKey("stats"),
+	periodKey("aggregate"),
+	periodKey("goals"),
+	{"frequency", "number of periods aggregated", isCount},
+	{"fn", "sum, avg, min, max, count or median", func(s string) bool {
+		_, ok := Aggregations[s]
+		return ok
+	}},
+	{"output", "table or graph", func(s string) bool {
+		return s == "table" || s == "graph"
+	}},
+	{"limit", "number of records listed", isCount},
+}
+
+// periodKey is the key of the default period of command,
+// as in aggregate.period.
+func periodKey(command string) configKey {
+	return configKey{command + ".period", "period of " + command + ", " + periodUsage, func(s string) bool {
+		_, err := parsePeriod(s)
+		return err == nil
+	}}
+}
+
+func isCount(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 0
+}
+
+func lookupConfigKey(name string) (configKey, error) {
+	for _, k := range configKeys {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	return configKey{}, &ErrConfigKey{name}
+}
+
+// get returns the value of key, fallback when it isnt set.
+func (cfg Config) get(key, fallback string) string {
+	if v, ok := cfg[key]; ok {
+		return v
+	}
+	return fallback
+}
+
+// getInt returns the value of a numeric key, values are
+// checked when they are set or loaded.
+func (cfg Config) getInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(cfg[key]); err == nil {
+		return n
+	}
+	return fallback
+}
+
+// set sets the value of key, an empty value unsets it.
+func (cfg Config) set(key, value string) error {
+	k, err := lookupConfigKey(key)
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		delete(cfg, key)
+		return nil
+	}
+
+	if k.check != nil && !k.check(value) {
+		return &ErrConfigValue{key, value, k.usage}
+	}
+	cfg[key] = value
+	return nil
+}
+
+func homeDir() (string, error) {
+	if home := os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+
+	u, err := user.Current()
+	if err != nil || u.HomeDir == "" {
+		return "", ErrNoHome
+	}
+	return u.HomeDir, nil
+}
+
+// xdgDir returns the directory of tracker under the xdg base
+// directory env, or under fallback in the home directory.
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); dir != "" {
+		return path.Join(dir, "tracker"), nil
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, fallback, "tracker"), nil
+}
+
+func configPath() (string, error) {
+	dir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "config.json"), nil
+}
+
+// loadConfig reads the configuration file p, a missing file is an
+// empty configuration. Values may be json strings or numbers. The
+// invalid values are skipped with a warning, unknown keys are kept
+// for the versions that know them. It fails when p cant be read.
+func loadConfig(p string) (Config, []string, error) {
+	var (
+		cfg      = make(Config)
+		values   map[string]json.RawMessage
+		warnings []string
+	)
+
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return cfg, nil, nil
+	} else if err != nil {
+		return cfg, nil, err
+	}
+
+	if err = json.Unmarshal(b, &values); err != nil {
+		return cfg, nil, fmt.Errorf("%s: %v", p, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var value string
+		if json.Unmarshal(values[key], &value) != nil {
+			value = string(values[key])
+		}
+
+		err = cfg.set(key, value)
+		if _, ok := err.(*ErrConfigKey); ok {
+			cfg[key] = value
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v Ignored.", p, err))
+		}
+	}
+	return cfg, warnings, nil
+}
+
+func saveConfig(p string, cfg Config) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, append(b, '\n'), 0644)
+}
+
+// loadConfigs returns the global configuration overridden by
+// the one of the current directory, along with the warnings of
+// the files. The files that cant be read are skipped, as is the
+// global one without home directory.
+func loadConfigs() (Config, []string) {
+	var (
+		cfg      = make(Config)
+		warnings []string
+	)
+
+	if p, err := configPath(); err != nil {
+		warnings = append(warnings, fmt.Sprintf("%v Global config skipped.", err))
+	} else if cfg, warnings, err = loadConfig(p); err != nil {
+		warnings = append(warnings, fmt.Sprintf("%v, skipped.", err))
+	}
+
+	local, localWarnings, err := loadConfig(localConfig)
+	if err != nil {
+		localWarnings = append(localWarnings, fmt.Sprintf("%v, skipped.", err))
+	}
+	for k, v := range local {
+		cfg[k] = v
+	}
+	return cfg, append(warnings, localWarnings...)
+}
+
+// expandHome replaces the leading ~ of p by the home directory.
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, p[1:]), nil
+}
+
+// trackerDir resolves the directory of the trackers, dir when set,
+// then the one of the configuration and the xdg data directory.
+// Trackers kept in ~/Dropbox/tracker by former versions stay there.
+func trackerDir(dir string, cfg Config) (string, error) {
+	if dir == "" {
+		dir = cfg.get("dir", "")
+	}
+
+	if dir != "" {
+		return expandHome(dir)
+	}
+
+	if home, err := homeDir(); err == nil {
+		if legacy := path.Join(home, "Dropbox", "tracker"); exists(legacy) {
+			return legacy, nil
+		}
+	}
+	return xdgDir("XDG_DATA_HOME", path.Join(".local", "share"))
+}
+
+// setTrackerDir resolves the directory of the trackers
+// and creates it on first use.
+func setTrackerDir(dir string, cfg Config) error {
+	dir, err := trackerDir(dir, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	TRACKER_DIR = dir
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerDir(t *testing.T) {
+	home, err := ioutil.TempDir("", "tracker_home")
+	assert.Nil(t, err)
+	defer os.RemoveAll(home)
+
+	for env, value := range map[string]string{"HOME": home, "XDG_CONFIG_HOME": "", "XDG_DATA_HOME": ""} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, value)
+	}
+
+	dir, err := trackerDir("", Config{})
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(home, ".local/share/tracker"), dir)
+
+	os.Setenv("XDG_DATA_HOME", path.Join(home, "data"))
+	dir, err = trackerDir("", Config{})
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(home, "data/tracker"), dir)
+
+	legacy := path.Join(home, "Dropbox/tracker")
+	assert.Nil(t, os.MkdirAll(legacy, 0755))
+	dir, err = trackerDir("", Config{})
+	assert.Nil(t, err)
+	assert.Equal(t, legacy, dir)
+
+	dir, err = trackerDir("", Config{"dir": "~/trackers"})
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(home, "trackers"), dir)
+
+	dir, err = trackerDir("/tmp/trackers", Config{"dir": "~/trackers"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/tmp/trackers", dir)
+}
+
+func TestConfig(t *testing.T) {
+	home, err := ioutil.TempDir("", "tracker_home")
+	assert.Nil(t, err)
+	defer os.RemoveAll(home)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	assert.Nil(t, os.Chdir(home))
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", path.Join(home, "config"))
+
+	cfg, warnings := loadConfigs()
+	assert.Equal(t, 0, len(warnings))
+	assert.Equal(t, Config{}, cfg)
+	assert.Equal(t, "default", cfg.get("tracker", "default"))
+	assert.Equal(t, 2, cfg.getInt("frequency", 2))
+
+	assert.Equal(t, &ErrConfigKey{"colour"}, cfg.set("colour", "red"))
+	assert.Equal(t, &ErrConfigValue{"frequency", "-1", "number of periods aggregated"}, cfg.set("frequency", "-1"))
+	assert.Equal(t, &ErrConfigValue{"output", "pie", "table or graph"}, cfg.set("output", "pie"))
+	assert.Nil(t, cfg.set("tracker", "work"))
+	assert.Nil(t, cfg.set("aggregate.period", "2weeks"))
+
+	p, err := configPath()
+	assert.Nil(t, err)
+	assert.Nil(t, saveConfig(p, cfg))
+	assert.Nil(t, ioutil.WriteFile(localConfig, []byte(`{"tracker": "home", "frequency": 4}`), 0644))
+
+	cfg, warnings = loadConfigs()
+	assert.Equal(t, 0, len(warnings))
+	assert.Equal(t, Config{"tracker": "home", "aggregate.period": "2weeks", "frequency": "4"}, cfg)
+	assert.Equal(t, 4, cfg.getInt("frequency", 2))
+
+	assert.Nil(t, cfg.set("aggregate.period", ""))
+	assert.Equal(t, "w", cfg.get("aggregate.period", "w"))
+	assert.Equal(t, &ErrConfigKey{"period"}, cfg.set("period", "d"))
+
+	// invalid values are skipped, unknown keys kept for newer versions
+	assert.Nil(t, ioutil.WriteFile(localConfig, []byte(`{"fn": "mean", "colour": "red", "limit": 5}`), 0644))
+	cfg, warnings = loadConfigs()
+	assert.Equal(t, 2, len(warnings))
+	assert.Equal(t, Config{"tracker": "work", "aggregate.period": "2weeks", "colour": "red", "limit": "5"}, cfg)
+
+	assert.Nil(t, ioutil.WriteFile(localConfig, []byte(`{"fn": `), 0644))
+	cfg, warnings = loadConfigs()
+	assert.Equal(t, 1, len(warnings))
+	assert.Equal(t, "work", cfg.get("tracker", "default"))
+
+	// so config set leaves the file alone
+	_, _, err = loadConfig(localConfig)
+	assert.NotNil(t, err)
+}
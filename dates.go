@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	datetimeLayout = "2006-01-02 15:04:05"
+	clockLayout    = "15:04"
+)
+
+type ErrInvalidDate struct {
+	value  string
+	reason string
+}
+
+func (err *ErrInvalidDate) Error() string {
+	return fmt.Sprintf("invalid date %q: %s.", err.value, err.reason)
+}
+
+type ErrInvalidZone struct {
+	name string
+}
+
+func (err *ErrInvalidZone) Error() string {
+	return fmt.Sprintf("unknown time zone %q, expected a zone like UTC or America/Los_Angeles.", err.name)
+}
+
+var locations = struct {
+	sync.Mutex
+	m map[string]*time.Location
+}{m: make(map[string]*time.Location)}
+
+// loadLocation returns the time zone of name, zones
+// are cached as the period queries load them per record.
+func loadLocation(name string) (*time.Location, error) {
+	locations.Lock()
+	defer locations.Unlock()
+
+	if loc, ok := locations.m[name]; ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, &ErrInvalidZone{name}
+	}
+	locations.m[name] = loc
+	return loc, nil
+}
+
+// defaultLocation returns the reporting time zone of the trackers
+// without one, TRACKER_TZ or the local time zone.
+func defaultLocation() (*time.Location, error) {
+	if name := os.Getenv("TRACKER_TZ"); name != "" {
+		return loadLocation(name)
+	}
+	return time.Local, nil
+}
+
+// parseDate parses an absolute date (2006-01-02), a relative one
+// (today, yesterday, -3d, -2w, -1m, -1y), optionally followed by a
+// time of day (15:04). Dates are relative to now.
+func parseDate(s string, now time.Time) (time.Time, error) {
+	var (
+		date  time.Time
+		clock string
+
+		fields = strings.Fields(strings.ToLower(s))
+	)
+
+	switch len(fields) {
+	case 2:
+		clock = fields[1]
+		fallthrough
+	case 1:
+		var ok bool
+		if date, ok = relativeDate(fields[0], now); !ok {
+			d, err := time.ParseInLocation(dateLayout, fields[0], now.Location())
+			if err != nil {
+				return date, &ErrInvalidDate{s, "expected 2006-01-02, today, yesterday or -Nd/w/m/y"}
+			}
+			date = d
+		}
+	default:
+		return date, &ErrInvalidDate{s, "expected a date and an optional time"}
+	}
+
+	if len(clock) > 0 {
+		c, err := time.Parse(clockLayout, clock)
+		if err != nil {
+			return date, &ErrInvalidDate{s, "expected a time like 15:04"}
+		}
+		date = time.Date(date.Year(), date.Month(), date.Day(), c.Hour(), c.Minute(), 0, 0, date.Location())
+	}
+
+	return date, nil
+}
+
+// parseRecordDate parses the date of a record, which
+// cant be in the future.
+func parseRecordDate(s string, now time.Time) (time.Time, error) {
+	date, err := parseDate(s, now)
+	if err == nil && !date.Before(midnight(now).AddDate(0, 0, 1)) {
+		err = &ErrInvalidDate{s, "date is in the future"}
+	}
+	return date, err
+}
+
+func relativeDate(s string, now time.Time) (time.Time, bool) {
+	today := midnight(now)
+
+	switch s {
+	case "today":
+		return today, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	if len(s) < 3 || s[0] != '-' {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(s[1 : len(s)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+
+	switch s[len(s)-1] {
+	case 'd':
+		return today.AddDate(0, 0, -n), true
+	case 'w':
+		return today.AddDate(0, 0, -7*n), true
+	case 'm':
+		return today.AddDate(0, -n, 0), true
+	case 'y':
+		return today.AddDate(-n, 0, 0), true
+	}
+	return time.Time{}, false
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// inLocation returns the time of loc on the wall clock of t.
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// formatDate formats the date of a record for display,
+// dates without time of day are shown as such.
+func formatDate(t time.Time) string {
+	if t.Equal(midnight(t)) {
+		return t.Format(dateLayout)
+	}
+	return t.Format(datetimeLayout)
+}
+
+// formatStoredDate formats t the way records store it, in utc.
+func formatStoredDate(t time.Time) string {
+	return t.UTC().Format(datetimeLayout)
+}
+
+// parseStoredDate parses a records date, dates of trackers
+// older than the utc storage may lack the time of day.
+func parseStoredDate(s string) (time.Time, error) {
+	return parseWallClock(s, time.UTC)
+}
+
+// parseWallClock parses a date of loc, with or without time of day.
+func parseWallClock(s string, loc *time.Location) (time.Time, error) {
+	if len(s) == len(dateLayout) {
+		return time.ParseInLocation(dateLayout, s, loc)
+	}
+	return time.ParseInLocation(datetimeLayout, s, loc)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2015, time.March, 2, 18, 30, 0, 0, time.Local)
+
+	valid := map[string]time.Time{
+		"today":            time.Date(2015, time.March, 2, 0, 0, 0, 0, time.Local),
+		"Yesterday":        time.Date(2015, time.March, 1, 0, 0, 0, 0, time.Local),
+		"-3d":              time.Date(2015, time.February, 27, 0, 0, 0, 0, time.Local),
+		"-2w":              time.Date(2015, time.February, 16, 0, 0, 0, 0, time.Local),
+		"-1m":              time.Date(2015, time.February, 2, 0, 0, 0, 0, time.Local),
+		"-1y":              time.Date(2014, time.March, 2, 0, 0, 0, 0, time.Local),
+		"2014-12-31":       time.Date(2014, time.December, 31, 0, 0, 0, 0, time.Local),
+		"2014-12-31 21:05": time.Date(2014, time.December, 31, 21, 5, 0, 0, time.Local),
+		"yesterday 08:00":  time.Date(2015, time.March, 1, 8, 0, 0, 0, time.Local),
+		"today 23:59":      time.Date(2015, time.March, 2, 23, 59, 0, 0, time.Local),
+	}
+	for s, expected := range valid {
+		date, err := parseDate(s, now)
+		assert.Nil(t, err, s)
+		assert.True(t, expected.Equal(date), s)
+	}
+
+	invalid := []string{"", "tomorrow", "-3", "-xd", "3d", "2015-02-30", "-1d 25:00", "today at noon"}
+	for _, s := range invalid {
+		_, err := parseDate(s, now)
+		_, ok := err.(*ErrInvalidDate)
+		assert.True(t, ok, s)
+	}
+}
+
+func TestParseRecordDate(t *testing.T) {
+	now := time.Date(2015, time.March, 2, 18, 30, 0, 0, time.Local)
+
+	_, err := parseRecordDate("today 23:59", now)
+	assert.Nil(t, err)
+
+	_, err = parseRecordDate("2015-03-03", now)
+	assert.Equal(t, &ErrInvalidDate{"2015-03-03", "date is in the future"}, err)
+
+	date, err := parseDate("2015-03-03", now)
+	assert.Nil(t, err)
+	assert.True(t, date.After(now))
+}
+
+func TestFormatDate(t *testing.T) {
+	assert.Equal(t, "2015-03-02", formatDate(time.Date(2015, time.March, 2, 0, 0, 0, 0, time.Local)))
+	assert.Equal(t, "2015-03-02 08:15:00", formatDate(time.Date(2015, time.March, 2, 8, 15, 0, 0, time.Local)))
+}
@@ -7,15 +7,30 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// driver is sqlite along with the functions of the tracker queries.
+const driver = "sqlite3_tracker"
+
+func init() {
+	sql.Register(driver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("wallclock", wallclock, true)
+		},
+	})
+}
+
 var (
 	ErrInvalidCategory = errors.New("category doesnt exist.")
+	ErrInvalidRecord   = errors.New("record doesnt exist.")
+	ErrDefaultCategory = errors.New("default category cant be removed.")
+	ErrSameCategory    = errors.New("cant merge a category into itself.")
 	ErrNoName          = errors.New("tracker name required.")
 )
 
@@ -27,30 +42,93 @@ func (err *ErrInvalidDB) Error() string {
 	return fmt.Sprintf("tracker %s doesnt exist.", err.db)
 }
 
+type ErrCategoryInUse struct {
+	id      int
+	records int
+}
+
+func (err *ErrCategoryInUse) Error() string {
+	return fmt.Sprintf("category %d is used by %d records, reassign them with --into.", err.id, err.records)
+}
+
+type ErrUnknownCategory struct {
+	name    string
+	matches []string
+}
+
+func (err *ErrUnknownCategory) Error() string {
+	if len(err.matches) == 0 {
+		return fmt.Sprintf("category %q doesnt exist.", err.name)
+	}
+	return fmt.Sprintf("category %q doesnt exist, did you mean %s?", err.name, strings.Join(err.matches, ", "))
+}
+
+type ErrCategoryExists struct {
+	names []string
+}
+
+func (err *ErrCategoryExists) Error() string {
+	return fmt.Sprintf("category already exists: %s.", strings.Join(err.names, ", "))
+}
+
+const (
+	// defaultCategory is the category records get when none is given.
+	defaultCategory = 1
+
+	recordsTable = "records left join categories on categories.id = records.category"
+)
+
 type DB struct {
 	*sql.DB
+
+	// loc is the time zone records are reported in.
+	loc *time.Location
+	// cal is the calendar of the period queries.
+	cal Calendar
+}
+
+type record struct {
+	id       int
+	qty      int64
+	date     time.Time
+	category int
+	catname  string
+	note     string
+	tags     []string
 }
 
-func (db *DB) query(q string, period Period) ([]timeData, error) {
-	rows, err := db.Query(q)
+func (db *DB) query(qry *query, period Period) ([]timeData, error) {
+	stmt, err := db.Prepare(qry.String())
+	if err != nil {
+		return []timeData{}, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(qry.Args()...)
 	if err != nil {
 		return []timeData{}, err
 	}
 	defer rows.Close()
 
 	var (
-		res  = make([]timeData, 0)
-		data = timeData{period: period}
+		res = make([]timeData, 0)
 
-		datestr string
+		datestr, valuestr string
 	)
 	for rows.Next() {
-		err = rows.Scan(&data.qty, &datestr)
+		data := timeData{period: period, cal: db.cal}
+
+		err = rows.Scan(&data.sum, &data.count, &data.min, &data.max, &valuestr, &datestr, &data.category)
 		if err != nil {
 			return res, err
 		}
 
-		data.date, err = time.Parse("2006-01-02", datestr)
+		data.values, err = parseValues(valuestr)
+		if err != nil {
+			return res, err
+		}
+
+		data.date, err = parseWallClock(datestr, db.loc)
 		if err != nil {
 			return res, err
 		}
@@ -60,9 +138,12 @@ func (db *DB) query(q string, period Period) ([]timeData, error) {
 }
 
 func (db *DB) queryLastRecord(category int, period Period) (timeData, error) {
-	qry := "select records.qty, records.date from records " +
-		"where records.category = " + fmt.Sprintf("%d ", category) +
-		"order by records.date desc limit 1"
+	// the stats of a single record
+	qry := newQuery(recordsTable, "records.qty", "1", "records.qty", "records.qty", "cast(records.qty as text)",
+		wallclockExpr(db.loc), "coalesce(categories.name, '')").
+		where("records.category = ?", category).
+		order("records.date desc").
+		max(1)
 	datas, err := db.query(qry, period)
 	if err != nil {
 		return timeData{}, err
@@ -75,63 +156,43 @@ func (db *DB) queryLastRecord(category int, period Period) (timeData, error) {
 	return datas[0], nil
 }
 
-func (db *DB) queryDay(frequency int, categories []int) ([]timeData, error) {
-	date := time.Now().AddDate(0, 0, -1*frequency)
-	month, day := fmt.Sprintf("'%02d'", int(date.Month())), fmt.Sprintf("'%02d'", date.Day())
-	qry := "select sum(records.qty) as quantity, records.date from records" +
-		" where strftime('%Y', records.date) >= '" + itoa(date.Year()) + "'" +
-		" and (strftime('%m', records.date) > " + month +
-		" or (strftime('%m', records.date) = " + month +
-		" and strftime('%d', records.date) >= " + day + ")) " + catCondition(categories) +
-		"group by strftime('%Y-%m-%d', records.date)"
-
-	return db.query(qry, DAY)
-}
-
-func (db *DB) queryWeek(frequency int, categories []int) ([]timeData, error) {
-	date := time.Now().AddDate(0, 0, -7*frequency)
-	year, week := date.ISOWeek()
-	qry := "select sum(records.qty) as quantity, records.date from records " +
-		"where ((strftime('%Y', date) = '" + itoa(year) + "'" +
-		" and (strftime('%j', date(records.date, '-3 days', 'weekday 4')) - 1) / 7 + 1 >= " + itoa(week) + ") " +
-		"or strftime('%Y', date) > '" + itoa(year) + "') " + catCondition(categories) +
-		"group by strftime('%Y', date), (strftime('%j', date(records.date, '-3 days', 'weekday 4')) - 1) / 7 + 1"
-
-	return db.query(qry, WEEK)
-}
-
-func (db *DB) queryMonth(frequency int, categories []int) ([]timeData, error) {
-	date := time.Now().AddDate(0, -1*frequency, 0)
-	year, month := date.Year(), int(date.Month())
-	qry := "select sum(records.qty) as quantity, records.date from records " +
-		"where ((strftime('%Y', records.date) = '" + itoa(year) + "' and strftime('%m', records.date) >= " + fmt.Sprintf("'%02d') ", month) +
-		"or strftime('%Y', records.date) > '" + itoa(year) + "') " + catCondition(categories) +
-		"group by strftime('%Y-%m', records.date)"
+// queryPeriod aggregates the records from the time from to the
+// day to included, grouped by period. Each group is dated by the
+// beginning of its period. Bounds are read on the wall clock of
+// the tracker time zone, whatever their own.
+func (db *DB) queryPeriod(period Period, from, to time.Time, categories, tags []int) ([]timeData, error) {
+	qry := periodQuery(periodStart(period, db.loc, db.cal), categories, tags).
+		where("records.date >= ?", formatStoredDate(inLocation(from, db.loc))).
+		where("records.date < ?", formatStoredDate(midnight(inLocation(to, db.loc)).AddDate(0, 0, 1)))
 
-	return db.query(qry, MONTH)
-}
-
-func (db *DB) queryYear(frequency int, categories []int) ([]timeData, error) {
-	date := time.Now().AddDate(-1*frequency, 0, 0)
-	qry := "select sum(records.qty) as quantity, records.date from records " +
-		"where strftime('%Y', records.date) >= '" + itoa(date.Year()) + "' " + catCondition(categories) +
-		"group by strftime('%Y', records.date)"
-
-	return db.query(qry, YEAR)
+	return db.query(qry, period)
 }
 
+// addCategories adds the categories whose name isnt taken, regardless
+// of case. The names that already exist are reported by ErrCategoryExists.
 func (db *DB) addCategories(names ...string) error {
-	stmt, err := db.Prepare("insert into categories(name) values(?)")
+	stmt, err := db.Prepare("insert or ignore into categories(name) values(?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
+	var existing []string
 	for _, name := range names {
-		_, err = stmt.Exec(name)
+		res, err := stmt.Exec(name)
 		if err != nil {
 			return err
 		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			existing = append(existing, name)
+		}
+	}
+
+	if len(existing) > 0 {
+		return &ErrCategoryExists{existing}
 	}
 	return nil
 }
@@ -139,7 +200,9 @@ func (db *DB) addCategories(names ...string) error {
 func (db *DB) getCategory(id int) (string, error) {
 	var name string
 
-	err := db.QueryRow("select name from categories where id = ?", id).Scan(&name)
+	qry := newQuery("categories", "name").where("id = ?", id)
+
+	err := db.QueryRow(qry.String(), qry.Args()...).Scan(&name)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", ErrInvalidCategory
@@ -157,7 +220,9 @@ func (db *DB) getCategories() (map[int]string, error) {
 		res = make(map[int]string)
 	)
 
-	rows, err := db.Query("select id, name from categories")
+	qry := newQuery("categories", "id", "name")
+
+	rows, err := db.Query(qry.String(), qry.Args()...)
 	if err != nil {
 		return res, err
 	}
@@ -173,26 +238,552 @@ func (db *DB) getCategories() (map[int]string, error) {
 	return res, rows.Err()
 }
 
-func (db *DB) addRecord(qty int64, category int) error {
+// resolveCategory returns the id of the category referenced by
+// ref, either its id or its name regardless of case.
+func (db *DB) resolveCategory(ref string) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		_, err = db.getCategory(id)
+		return id, err
+	}
+
+	var id int
+
+	qry := newQuery("categories", "id").
+		where("lower(name) = lower(?)", ref).
+		order("id").
+		max(1)
+
+	err := db.QueryRow(qry.String(), qry.Args()...).Scan(&id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+
+		categories, cerr := db.getCategories()
+		if cerr != nil {
+			return 0, cerr
+		}
+
+		names := make([]string, 0, len(categories))
+		for _, name := range categories {
+			names = append(names, name)
+		}
+		return 0, &ErrUnknownCategory{ref, closeMatches(ref, names)}
+	}
+	return id, nil
+}
+
+func (db *DB) resolveCategories(refs []string) ([]int, error) {
+	ids := make([]int, len(refs))
+	for i, ref := range refs {
+		id, err := db.resolveCategory(ref)
+		if err != nil {
+			return ids, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func (db *DB) renameCategory(id int, name string) error {
+	if _, err := db.getCategory(id); err != nil {
+		return err
+	}
+
+	var count int
+
+	qry := newQuery("categories", "count(*)").
+		where("lower(name) = lower(?)", name).
+		where("id != ?", id)
+	if err := db.QueryRow(qry.String(), qry.Args()...).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return &ErrCategoryExists{[]string{name}}
+	}
+
+	res, err := db.Exec("update categories set name = ? where id = ?", name, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, ErrInvalidCategory)
+}
+
+// deleteCategory removes a category that no record references.
+func (db *DB) deleteCategory(id int) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		if err := removableCategory(tx, id); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.QueryRow("select count(*) from records where category = ?", id).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return &ErrCategoryInUse{id, count}
+		}
+
+		if _, err := tx.Exec("delete from goals where category = ?", id); err != nil {
+			return err
+		}
+		_, err := tx.Exec("delete from categories where id = ?", id)
+		return err
+	})
+}
+
+// mergeCategories moves the records of from into another
+// category and removes from.
+func (db *DB) mergeCategories(from, into int) error {
+	if from == into {
+		return ErrSameCategory
+	}
+
+	return db.withTx(func(tx *sql.Tx) error {
+		if err := removableCategory(tx, from); err != nil {
+			return err
+		}
+
+		var id int
+		if err := tx.QueryRow("select id from categories where id = ?", into).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidCategory
+			}
+			return err
+		}
+
+		if _, err := tx.Exec("update records set category = ? where category = ?", into, from); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("delete from goals where category = ?", from); err != nil {
+			return err
+		}
+		_, err := tx.Exec("delete from categories where id = ?", from)
+		return err
+	})
+}
+
+func removableCategory(tx *sql.Tx, id int) error {
+	if id == defaultCategory {
+		return ErrDefaultCategory
+	}
+
+	var name string
+	if err := tx.QueryRow("select name from categories where id = ?", id).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidCategory
+		}
+		return err
+	}
+	return nil
+}
+
+// withTx runs fn in a transaction, rolled back when fn fails.
+func (db *DB) withTx(fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *DB) addRecord(qty int64, category int, date time.Time) error {
+	_, err := db.insertRecord(record{qty: qty, category: category, date: date})
+	return err
+}
+
+// insertRecord adds r along with its note and tags, tags
+// are created on first use. It returns the id of the record.
+func (db *DB) insertRecord(r record) (int, error) {
+	if _, err := db.getCategory(r.category); err != nil {
+		return 0, err
+	}
+
+	for _, tag := range r.tags {
+		if err := checkTag(tag); err != nil {
+			return 0, err
+		}
+	}
+
+	err := db.withTx(func(tx *sql.Tx) (err error) {
+		r.id, err = insertRecordTx(tx, r)
+		return err
+	})
+	return r.id, err
+}
+
+// insertRecordTx adds r in tx, its category and tags are
+// expected to be valid.
+func insertRecordTx(tx *sql.Tx, r record) (int, error) {
+	res, err := tx.Exec("insert into records(qty, category, date, note) values(?, ?, ?, ?)",
+		r.qty, r.category, formatStoredDate(r.date), r.note)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tagRecord(tx, int(id), r.tags)
+}
+
+func (db *DB) recordsQuery() *query {
+	return newQuery(recordsTable, "records.id", "records.qty", "records.date",
+		"records.category", "coalesce(categories.name, '')", "records.note",
+		"coalesce((select group_concat(tags.name) from record_tags join tags on tags.id = record_tags.tag "+
+			"where record_tags.record = records.id), '')")
+}
+
+func (db *DB) scanRecords(qry *query) ([]record, error) {
+	rows, err := db.Query(qry.String(), qry.Args()...)
+	if err != nil {
+		return []record{}, err
+	}
+	defer rows.Close()
+
+	var (
+		res = make([]record, 0)
+		r   record
+
+		datestr, tags string
+	)
+	for rows.Next() {
+		err = rows.Scan(&r.id, &r.qty, &datestr, &r.category, &r.catname, &r.note, &tags)
+		if err != nil {
+			return res, err
+		}
+
+		r.tags = nil
+		if tags != "" {
+			r.tags = strings.Split(tags, ",")
+			sort.Strings(r.tags)
+		}
+
+		r.date, err = parseStoredDate(datestr)
+		if err != nil {
+			return res, err
+		}
+		r.date = r.date.In(db.loc)
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) getRecord(id int) (record, error) {
+	records, err := db.scanRecords(db.recordsQuery().where("records.id = ?", id))
+	if err != nil {
+		return record{}, err
+	}
+
+	if len(records) == 0 {
+		return record{}, ErrInvalidRecord
+	}
+	return records[0], nil
+}
+
+// getRecords returns the latest records of categories and of any
+// of tags, all records when none are given. limit <= 0 returns every
+// record.
+func (db *DB) getRecords(categories, tags []int, limit int) ([]record, error) {
+	qry := tagged(db.recordsQuery(), tags).
+		in("records.category", categories).
+		order("records.date desc, records.id desc").
+		max(limit)
+
+	return db.scanRecords(qry)
+}
+
+func (db *DB) updateRecord(id int, qty int64, category int, date time.Time) error {
 	if _, err := db.getCategory(category); err != nil {
 		return err
 	}
 
-	_, err := db.Exec("insert into records(qty, category) values(?, ?)", qty, category)
+	res, err := db.Exec("update records set qty = ?, category = ?, date = ? where id = ?",
+		qty, category, formatStoredDate(date), id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, ErrInvalidRecord)
+}
+
+func (db *DB) deleteRecord(id int) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("delete from records where id = ?", id)
+		if err != nil {
+			return err
+		}
+
+		if err = expectAffected(res, ErrInvalidRecord); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("delete from record_tags where record = ?", id)
+		return err
+	})
+}
+
+// expectAffected returns notFound when res didnt affect any row.
+func expectAffected(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// periodQuery returns the base query of the period aggregations,
+// grouped by start and category and restricted to categories and
+// tags when any are given. Each group sums, counts and bounds its
+// quantities and lists them for the aggregations sqlite lacks.
+func periodQuery(start string, categories, tags []int) *query {
+	qry := newQuery(recordsTable, "sum(records.qty) as quantity", "count(records.qty)",
+		"min(records.qty)", "max(records.qty)", "group_concat(records.qty)",
+		start, "coalesce(categories.name, '')")
+
+	return tagged(qry, tags).
+		in("records.category", categories).
+		group(start, "records.category")
+}
+
+// periodStart returns the sql expression of the beginning of the
+// period of a record in loc and cal, as timeData.Start computes it.
+func periodStart(period Period, loc *time.Location, cal Calendar) string {
+	var (
+		date  = wallclockExpr(loc)
+		n     = itoa(period.units())
+		ws    = itoa(cal.weekShift)
+		ys    = itoa(cal.yearShift)
+		since = "'" + epoch.Format(dateLayout) + "'"
+		days  = "cast(julianday(date(" + date + ")) - julianday(" + since + ") as integer)"
+	)
+
+	switch period.unit {
+	case HOURS:
+		hours := "(" + days + " * 24 + cast(strftime('%H', " + date + ") as integer))"
+		return "datetime(" + since + ", '+' || (" + hours + " - " + hours + " % " + n + ") || ' hours')"
+	case WEEKS:
+		// epoch is a monday, as iso weeks start on monday
+		weeks := "(" + days + " + " + ws + ")"
+		n = itoa(7 * period.n)
+		return "date(" + since + ", '+' || (" + weeks + " - " + weeks + " % " + n + " - " + ws + ") || ' days')"
+	case DAYS:
+		return "date(" + since + ", '+' || (" + days + " - " + days + " % " + n + ") || ' days')"
+	case MONTHS, QUARTERS:
+		months := "(cast(strftime('%Y', " + date + ") as integer) * 12 + cast(strftime('%m', " + date + ") as integer) - 1 - " + ys + ")"
+		start := "(" + months + " - " + months + " % " + n + " + " + ys + ")"
+		return "printf('%04d-%02d-01', " + start + " / 12, " + start + " % 12 + 1)"
+	case YEARS:
+		// years beginning after january are numbered after the year they begin in
+		year := "(cast(strftime('%Y', " + date + ") as integer) - (cast(strftime('%m', " + date + ") as integer) <= " + ys + "))"
+		return "printf('%04d-%02d-01', " + year + " - " + year + " % " + n + ", " + ys + " + 1)"
+	}
+	return "date(" + date + ")"
+}
+
+// wallclockExpr returns the sql expression of the date
+// of a record on the wall clock of loc.
+func wallclockExpr(loc *time.Location) string {
+	return "wallclock(records.date, '" + strings.Replace(loc.String(), "'", "''", -1) + "')"
+}
+
+// wallclock converts a stored date to the wall clock of the
+// time zone name, it is registered as an sql function.
+func wallclock(date, name string) (string, error) {
+	loc, err := loadLocation(name)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := parseStoredDate(date)
+	if err != nil {
+		return "", err
+	}
+	return t.In(loc).Format(datetimeLayout), nil
+}
+
+func (db *DB) getSetting(name string) (string, error) {
+	var value string
+
+	err := db.QueryRow("select value from settings where name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+// setSetting sets the tracker setting name, empty values unset it.
+func (db *DB) setSetting(name, value string) error {
+	if value == "" {
+		_, err := db.Exec("delete from settings where name = ?", name)
+		return err
+	}
+
+	_, err := db.Exec("insert or replace into settings(name, value) values(?, ?)", name, value)
 	return err
 }
 
-func catCondition(categories []int) string {
-	var cond string
+// setLocation sets the time zone the tracker reports in,
+// an empty name resets it to the default time zone.
+func (db *DB) setLocation(name string) error {
+	if name != "" {
+		if _, err := loadLocation(name); err != nil {
+			return err
+		}
+	}
 
-	if len(categories) > 0 {
-		cond = fmt.Sprintf("and (records.category = %d", categories[0])
-		for i := 1; i < len(categories); i++ {
-			cond += fmt.Sprintf(" or records.category = %d", categories[i])
+	if err := db.setSetting("timezone", name); err != nil {
+		return err
+	}
+	return db.loadLocation()
+}
+
+// setWeekStart sets the day the weeks of the tracker
+// begin, an empty day resets them to iso weeks.
+func (db *DB) setWeekStart(day string) error {
+	if day != "" {
+		if _, err := parseWeekStart(day); err != nil {
+			return err
 		}
-		cond += ")"
 	}
-	return cond
+
+	if err := db.setSetting("weekstart", day); err != nil {
+		return err
+	}
+	return db.loadCalendar()
+}
+
+// setYearStart sets the month the years of the tracker
+// begin, an empty month resets them to calendar years.
+func (db *DB) setYearStart(month string) error {
+	if month != "" {
+		if _, err := parseYearStart(month); err != nil {
+			return err
+		}
+	}
+
+	if err := db.setSetting("yearstart", month); err != nil {
+		return err
+	}
+	return db.loadCalendar()
+}
+
+func (db *DB) loadCalendar() error {
+	var cal Calendar
+
+	week, err := db.getSetting("weekstart")
+	if err == nil && week != "" {
+		cal.weekShift, err = parseWeekStart(week)
+	}
+	if err != nil {
+		return err
+	}
+
+	year, err := db.getSetting("yearstart")
+	if err == nil && year != "" {
+		cal.yearShift, err = parseYearStart(year)
+	}
+	if err != nil {
+		return err
+	}
+
+	db.cal = cal
+	return nil
+}
+
+// loadLocation loads the time zone of the tracker,
+// the default time zone unless it has its own.
+func (db *DB) loadLocation() error {
+	name, err := db.getSetting("timezone")
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		db.loc, err = defaultLocation()
+	} else {
+		db.loc, err = loadLocation(name)
+	}
+	return err
+}
+
+// closeMatches returns the names that contain s or are
+// a few edits away from it, ignoring case.
+func closeMatches(s string, names []string) []string {
+	var (
+		matches []string
+
+		ls = strings.ToLower(s)
+	)
+
+	for _, name := range names {
+		ln := strings.ToLower(name)
+		if strings.Contains(ln, ls) || strings.Contains(ls, ln) ||
+			levenshtein(ls, ln) <= len(ls)/3+1 {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func levenshtein(a, b string) int {
+	var (
+		ra, rb = []rune(a), []rune(b)
+
+		prev = make([]int, len(rb)+1)
+		cur  = make([]int, len(rb)+1)
+	)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// parseValues parses quantities listed by group_concat.
+func parseValues(s string) ([]int64, error) {
+	var (
+		fields = strings.Split(s, ",")
+		values = make([]int64, len(fields))
+
+		err error
+	)
+	for i, field := range fields {
+		values[i], err = strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return values, err
+		}
+	}
+	return values, nil
 }
 
 func itoa(n int) string {
@@ -219,16 +810,29 @@ func dblist() ([]string, error) {
 
 func open(p string) (*DB, error) {
 	if !exists(p) {
-		create(p)
+		if err := create(p); err != nil {
+			return nil, err
+		}
 	}
 
-	db, err := sql.Open("sqlite3", p)
+	db, err := sql.Open(driver, p)
 	if err != nil {
 		return nil, err
 	}
-	err = db.Ping()
 
-	return &DB{db}, err
+	tdb := &DB{DB: db}
+	if err = db.Ping(); err == nil {
+		if err = migrate(db); err == nil {
+			if err = tdb.loadLocation(); err == nil {
+				err = tdb.loadCalendar()
+			}
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return tdb, nil
 }
 
 func create(p string) error {
@@ -236,24 +840,13 @@ func create(p string) error {
 		return err
 	}
 
-	db, err := sql.Open("sqlite3", p)
+	db, err := sql.Open(driver, p)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	exec := func(query string) {
-		if err != nil {
-			return
-		}
-		_, err = db.Exec(query)
-	}
-
-	exec("CREATE TABLE categories(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name text NOT NULL)")
-	exec("CREATE TABLE records(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, qty integer NOT NULL, " +
-		"date integer NOT NULL DEFAULT CURRENT_DATE, category integer NOT NULL DEFAULT 1)")
-	exec("INSERT INTO categories(name) VALUES('default')")
-	return err
+	return migrate(db)
 }
 
 func exists(p string) bool {
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
+	"path"
 	"testing"
 	"time"
 
@@ -28,6 +30,28 @@ func TestMain(m *testing.M) {
 	m.Run()
 }
 
+// tempPath returns the path of a tracker of its own in the
+// temp directory, it is removed once the test ends.
+func tempPath(t *testing.T, name string) string {
+	p := path.Join(os.TempDir(), "tracker_"+name+".db")
+	os.Remove(p)
+
+	t.Cleanup(func() { os.Remove(p) })
+	return p
+}
+
+// tempDB opens a tracker at the tempPath of name,
+// it is closed once the test ends.
+func tempDB(t *testing.T, name string) *DB {
+	db, err := open(tempPath(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
 func TestDB(t *testing.T) {
 	assert.False(t, exists(dbtest))
 	assert.Nil(t, create(dbtest))
@@ -38,6 +62,10 @@ func TestDB(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 	assert.Nil(t, db.Close())
+
+	db, err = open(path.Join(dbtest, "nested.db"))
+	assert.NotNil(t, err)
+	assert.Nil(t, db)
 }
 
 func TestDblist(t *testing.T) {
@@ -48,6 +76,65 @@ func TestDblist(t *testing.T) {
 	assert.Equal(t, "test", names[0])
 }
 
+func TestMigrate(t *testing.T) {
+	p := tempPath(t, "migrate")
+
+	// tracker created before versioning
+	legacy, err := sql.Open("sqlite3", p)
+	assert.Nil(t, err)
+	for _, q := range []string{
+		"CREATE TABLE categories(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name text NOT NULL)",
+		"CREATE TABLE records(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, qty integer NOT NULL, " +
+			"date integer NOT NULL DEFAULT CURRENT_DATE, category integer NOT NULL DEFAULT 1)",
+		"INSERT INTO categories(name) VALUES('default'), ('foo'), ('Foo'), ('FOO')",
+		"INSERT INTO records(qty, category) VALUES(100, 3), (200, 4)",
+		"INSERT INTO records(qty, date) VALUES(300, '2025-12-31'), (400, '2026-10-10 09:30:00')",
+	} {
+		_, err = legacy.Exec(q)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, legacy.Close())
+
+	// legacy dates are on the wall clock of the default zone
+	os.Setenv("TRACKER_TZ", "America/Los_Angeles")
+	defer os.Unsetenv("TRACKER_TZ")
+
+	db, err := open(p)
+	assert.Nil(t, err)
+
+	version, err := userVersion(db.DB)
+	assert.Nil(t, err)
+	assert.Equal(t, schemaVersion(), version)
+
+	categories, err := db.getCategories()
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]string{1: "default", 2: "foo"}, categories)
+
+	records, err := db.getRecords([]int{2}, []int{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	// legacy dates are days of the local time zone
+	assert.True(t, records[0].date.Equal(midnight(records[0].date)))
+
+	records, err = db.getRecords([]int{1}, []int{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-10-10 09:30:00", formatDate(records[0].date))
+	assert.Equal(t, "2025-12-31", formatDate(records[1].date))
+
+	var stored string
+	assert.Nil(t, db.QueryRow("select date from records where qty = 300").Scan(&stored))
+	assert.Equal(t, "2025-12-31 08:00:00", stored)
+	assert.Equal(t, &ErrCategoryExists{[]string{"FOO"}}, db.addCategories("FOO"))
+
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion()+1))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	db, err = open(p)
+	assert.Equal(t, &ErrSchemaVersion{schemaVersion() + 1}, err)
+	assert.Nil(t, db)
+}
+
 func TestCategories(t *testing.T) {
 	testDB, _ = open(dbtest)
 
@@ -70,50 +157,83 @@ func TestCategories(t *testing.T) {
 	categories, err = testDB.getCategories()
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(categories))
+
+	err = testDB.addCategories("Foo", "baz")
+	assert.Equal(t, &ErrCategoryExists{[]string{"Foo", "baz"}}, err)
+	assert.Equal(t, &ErrCategoryExists{[]string{"BAR"}}, testDB.renameCategory(2, "BAR"))
+	assert.Nil(t, testDB.renameCategory(2, "Foo"))
+	assert.Nil(t, testDB.renameCategory(2, "foo"))
+
+	categories, err = testDB.getCategories()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(categories))
+}
+
+func TestResolveCategory(t *testing.T) {
+	id, err := testDB.resolveCategory("2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, id)
+
+	id, err = testDB.resolveCategory("FOO")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, id)
+
+	_, err = testDB.resolveCategory("42")
+	assert.Equal(t, ErrInvalidCategory, err)
+
+	_, err = testDB.resolveCategory("ba")
+	assert.Equal(t, &ErrUnknownCategory{"ba", []string{"bar", "baz"}}, err)
+
+	_, err = testDB.resolveCategory("defualt")
+	assert.Equal(t, &ErrUnknownCategory{"defualt", []string{"default"}}, err)
+
+	ids, err := testDB.resolveCategories([]string{"baz", "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{4, 1}, ids)
 }
 
 func TestAddRecord(t *testing.T) {
-	err := testDB.addRecord(1200, 2)
+	err := testDB.addRecord(1200, 2, time.Now())
 	assert.Nil(t, err)
 }
 
 func TestQueryWeek(t *testing.T) {
-	datas, err := testDB.queryWeek(0, []int{2})
+	datas, err := testDB.queryPeriod(WEEK, timeData{date: date, period: WEEK}.Start(), date, []int{2}, []int{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 1, len(datas))
 	assert.Equal(t, 1200, datas[0].Quantity())
 	assert.Equal(t, fmt.Sprintf("W%02d %d", week, year), datas[0].Key())
 
-	datas, err = testDB.queryWeek(0, []int{3})
+	datas, err = testDB.queryPeriod(WEEK, timeData{date: date, period: WEEK}.Start(), date, []int{3}, []int{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 0, len(datas))
 }
 
 func TestQueryMonth(t *testing.T) {
-	datas, err := testDB.queryMonth(2, []int{2})
+	datas, err := testDB.queryPeriod(MONTH, date.AddDate(0, -2, 0), date, []int{2}, []int{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 1, len(datas))
 	assert.Equal(t, 1200, datas[0].Quantity())
 	assert.Equal(t, fmt.Sprintf("%d %s", date.Year(), date.Month().String()), datas[0].Key())
 
-	datas, err = testDB.queryMonth(0, []int{1})
+	datas, err = testDB.queryPeriod(MONTH, date, date, []int{1}, []int{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 0, len(datas))
 }
 
 func TestQueryYear(t *testing.T) {
-	datas, err := testDB.queryYear(2, []int{2})
+	datas, err := testDB.queryPeriod(YEAR, date.AddDate(-2, 0, 0), date, []int{2}, []int{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 1, len(datas))
 	assert.Equal(t, 1200, datas[0].Quantity())
 	assert.Equal(t, fmt.Sprintf("%d", date.Year()), datas[0].Key())
 
-	datas, err = testDB.queryYear(0, []int{1})
+	datas, err = testDB.queryPeriod(YEAR, date, date, []int{1}, []int{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 0, len(datas))
@@ -142,3 +262,246 @@ func TestWithDBContext(t *testing.T) {
 	err = withDBContext("test", fn)
 	assert.Nil(t, err)
 }
+
+func TestRecords(t *testing.T) {
+	err := withDBContext("test", func(db *DB) error {
+		records, err := db.getRecords([]int{}, []int{}, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(records))
+		assert.Equal(t, int64(1200), records[0].qty)
+		assert.Equal(t, "foo", records[0].catname)
+
+		backdate := time.Date(2014, time.December, 31, 21, 0, 0, 0, time.Local)
+		assert.Nil(t, db.addRecord(500, 3, backdate))
+
+		records, err = db.getRecords([]int{3}, []int{}, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(records))
+		assert.True(t, backdate.Equal(records[0].date))
+
+		id := records[0].id
+		assert.Equal(t, ErrInvalidCategory, db.updateRecord(id, 700, 42, backdate))
+		assert.Equal(t, ErrInvalidRecord, db.updateRecord(42, 700, 2, backdate))
+		assert.Nil(t, db.updateRecord(id, 700, 4, backdate))
+
+		r, err := db.getRecord(id)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(700), r.qty)
+		assert.Equal(t, "baz", r.catname)
+
+		assert.Nil(t, db.deleteRecord(id))
+		assert.Equal(t, ErrInvalidRecord, db.deleteRecord(id))
+
+		_, err = db.getRecord(id)
+		assert.Equal(t, ErrInvalidRecord, err)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestEditCategories(t *testing.T) {
+	err := withDBContext("test", func(db *DB) error {
+		assert.Nil(t, db.renameCategory(3, "qux"))
+		assert.Equal(t, ErrInvalidCategory, db.renameCategory(42, "qux"))
+
+		name, err := db.getCategory(3)
+		assert.Nil(t, err)
+		assert.Equal(t, "qux", name)
+
+		assert.Equal(t, &ErrCategoryInUse{2, 1}, db.deleteCategory(2))
+		assert.Equal(t, ErrDefaultCategory, db.deleteCategory(1))
+		assert.Equal(t, ErrInvalidCategory, db.deleteCategory(42))
+		assert.Nil(t, db.deleteCategory(3))
+
+		assert.Equal(t, ErrSameCategory, db.mergeCategories(2, 2))
+		assert.Equal(t, ErrInvalidCategory, db.mergeCategories(2, 42))
+		assert.Equal(t, ErrDefaultCategory, db.mergeCategories(1, 2))
+		assert.Nil(t, db.mergeCategories(2, 4))
+
+		_, err = db.getCategory(2)
+		assert.Equal(t, ErrInvalidCategory, err)
+
+		records, err := db.getRecords([]int{4}, []int{}, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(records))
+		assert.Equal(t, int64(1200), records[0].qty)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestLocation(t *testing.T) {
+	db := tempDB(t, "location")
+	assert.Equal(t, time.Local, db.loc)
+
+	assert.Equal(t, &ErrInvalidZone{"Mars/Olympus"}, db.setLocation("Mars/Olympus"))
+	assert.Nil(t, db.setLocation("America/Los_Angeles"))
+	assert.Equal(t, "America/Los_Angeles", db.loc.String())
+
+	evening := time.Date(2015, time.March, 1, 22, 0, 0, 0, db.loc)
+	assert.Nil(t, db.addRecord(100, 1, evening))
+
+	var stored string
+	assert.Nil(t, db.QueryRow("select date from records").Scan(&stored))
+	assert.Equal(t, "2015-03-02 06:00:00", stored)
+
+	// the zone is kept by the tracker
+	db.loc = nil
+	assert.Nil(t, db.loadLocation())
+	assert.Equal(t, "America/Los_Angeles", db.loc.String())
+
+	records, err := db.getRecords([]int{}, []int{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "2015-03-01 22:00:00", formatDate(records[0].date))
+
+	os.Setenv("TRACKER_TZ", "Asia/Tokyo")
+	defer os.Unsetenv("TRACKER_TZ")
+
+	assert.Nil(t, db.setLocation(""))
+	assert.Equal(t, "Asia/Tokyo", db.loc.String())
+}
+
+func TestQueryPeriodBoundaries(t *testing.T) {
+	db := tempDB(t, "periods")
+
+	// records are bucketed on the wall clock of the tracker zone
+	assert.Nil(t, db.setLocation("America/New_York"))
+
+	for _, r := range []struct {
+		date string
+		qty  int64
+	}{
+		{"2014-12-25", 100},
+		{"2014-12-30", 200},
+		{"2015-01-02", 300},
+		{"2015-03-08 02:30:00", 400}, // dst gap in most of north america
+		{"2015-12-31", 500},          // thursday of iso week 53
+		{"2016-01-03 23:59:00", 600}, // sunday of iso week 53
+		{"2016-01-04", 700},
+		{"2016-02-29", 800},
+		{"2016-03-01", 900},
+		{"2016-03-01 23:30:00", 50}, // next day in utc
+	} {
+		date, err := parseWallClock(r.date, db.loc)
+		assert.Nil(t, err)
+		assert.Nil(t, db.addRecord(r.qty, 1, date))
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(dateLayout, s, time.UTC)
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		period   Period
+		from, to string
+		expected map[string]int64
+	}{
+		{"days across new year", DAY, "2014-12-28", "2015-01-05",
+			map[string]int64{"2014 December 30 Tuesday": 200, "2015 January 02 Friday": 300}},
+		{"iso week 1 across new year", WEEK, "2014-12-29", "2015-01-04",
+			map[string]int64{"W01 2015": 500}},
+		{"iso week 53", WEEK, "2015-12-28", "2016-01-10",
+			map[string]int64{"W53 2015": 1100, "W01 2016": 700}},
+		{"bounds are whole days", DAY, "2016-01-03", "2016-01-03",
+			map[string]int64{"2016 January 03 Sunday": 600}},
+		{"dst gap", DAY, "2015-03-08", "2015-03-08",
+			map[string]int64{"2015 March 08 Sunday": 400}},
+		{"leap day", DAY, "2016-02-28", "2016-03-01",
+			map[string]int64{"2016 February 29 Monday": 800, "2016 March 01 Tuesday": 950}},
+		{"late evening", DAY, "2016-03-02", "2016-03-02",
+			map[string]int64{}},
+		{"leap month", MONTH, "2016-02-01", "2016-03-31",
+			map[string]int64{"2016 February": 800, "2016 March": 950}},
+		{"months across new year", MONTH, "2014-12-01", "2015-01-31",
+			map[string]int64{"2014 December": 300, "2015 January": 300}},
+		{"years", YEAR, "2014-01-01", "2016-12-31",
+			map[string]int64{"2014": 300, "2015": 1200, "2016": 3050}},
+		{"empty", YEAR, "2013-01-01", "2013-12-31",
+			map[string]int64{}},
+		{"quarters", QUARTER, "2014-10-01", "2016-03-31",
+			map[string]int64{"Q4 2014": 300, "Q1 2015": 700, "Q4 2015": 500, "Q1 2016": 3050}},
+		{"hours", HOUR, "2016-01-03", "2016-01-03",
+			map[string]int64{"2016 January 03 23:00": 600}},
+		{"6 hours", Period{HOURS, 6}, "2015-03-08", "2015-03-08",
+			map[string]int64{"2015 March 08 00:00": 400}},
+		{"14 days", Period{DAYS, 14}, "2015-12-01", "2016-01-31",
+			map[string]int64{"2015 December 28 Monday": 1800}},
+		{"2 weeks", Period{WEEKS, 2}, "2015-12-14", "2016-01-17",
+			map[string]int64{"W53 2015": 1800}},
+		{"2 months", Period{MONTHS, 2}, "2016-01-01", "2016-04-30",
+			map[string]int64{"2016 January": 2100, "2016 March": 950}},
+		{"2 years", Period{YEARS, 2}, "2014-01-01", "2016-12-31",
+			map[string]int64{"2014": 1500, "2016": 3050}},
+	}
+
+	for _, test := range tests {
+		datas, err := db.queryPeriod(test.period, day(test.from), day(test.to), []int{}, []int{})
+		assert.Nil(t, err, test.name)
+
+		res := make(map[string]int64)
+		for _, data := range datas {
+			assert.True(t, data.date.Equal(timeData{date: data.date, period: test.period}.Start()), test.name)
+			res[data.Key()] += data.Quantity()
+		}
+		assert.Equal(t, test.expected, res, test.name)
+	}
+}
+
+func TestQueryPeriodCalendar(t *testing.T) {
+	db := tempDB(t, "calendar")
+
+	assert.Equal(t, &ErrInvalidCalendar{"friday", "monday or sunday"}, db.setWeekStart("friday"))
+	assert.Nil(t, db.setWeekStart("sunday"))
+	assert.Nil(t, db.setYearStart("april"))
+
+	// the calendar is kept by the tracker
+	db.cal = Calendar{}
+	assert.Nil(t, db.loadCalendar())
+	assert.Equal(t, Calendar{1, 3}, db.cal)
+
+	for date, qty := range map[string]int64{
+		"2015-01-03": 100, // saturday
+		"2015-01-04": 200, // sunday
+		"2015-03-31": 300,
+		"2015-04-01": 400,
+	} {
+		d, err := parseWallClock(date, db.loc)
+		assert.Nil(t, err)
+		assert.Nil(t, db.addRecord(qty, 1, d))
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(dateLayout, s, db.loc)
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		period   Period
+		from, to string
+		expected map[string]int64
+	}{
+		{"sunday weeks", WEEK, "2014-12-28", "2015-01-10",
+			map[string]int64{"W01 2015": 100, "W02 2015": 200}},
+		{"fiscal quarters", QUARTER, "2015-01-01", "2015-06-30",
+			map[string]int64{"Q4 FY2014/15": 600, "Q1 FY2015/16": 400}},
+		{"fiscal years", YEAR, "2014-04-01", "2016-03-31",
+			map[string]int64{"FY2014/15": 600, "FY2015/16": 400}},
+		{"2 fiscal months", Period{MONTHS, 2}, "2015-02-01", "2015-05-31",
+			map[string]int64{"2015 February": 300, "2015 April": 400}},
+	}
+
+	for _, test := range tests {
+		datas, err := db.queryPeriod(test.period, day(test.from), day(test.to), []int{}, []int{})
+		assert.Nil(t, err, test.name)
+
+		res := make(map[string]int64)
+		for _, data := range datas {
+			assert.True(t, data.date.Equal(timeData{date: data.date, period: test.period, cal: db.cal}.Start()), test.name)
+			res[data.Key()] += data.Quantity()
+		}
+		assert.Equal(t, test.expected, res, test.name)
+	}
+}
@@ -2,47 +2,109 @@ package main
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
-type Period int
+// Dimension splits aggregates into series.
+type Dimension int
 
 const (
-	DAY Period = iota << 1
-	WEEK
-	MONTH
-	YEAR
+	TOTAL Dimension = iota
+	CATEGORY
+	TRACKER
 )
 
-var Periods = map[string]Period{
-	"d": DAY,
-	"w": WEEK,
-	"m": MONTH,
-	"y": YEAR,
+var Dimensions = map[string]Dimension{
+	"":         TOTAL,
+	"category": CATEGORY,
+	"cat":      CATEGORY,
+	"tracker":  TRACKER,
+	"t":        TRACKER,
+}
+
+// Aggregation summarizes the quantities of a period.
+type Aggregation int
+
+const (
+	SUM Aggregation = iota
+	AVG
+	MIN
+	MAX
+	COUNT
+	MEDIAN
+)
+
+var Aggregations = map[string]Aggregation{
+	"sum":    SUM,
+	"avg":    AVG,
+	"min":    MIN,
+	"max":    MAX,
+	"count":  COUNT,
+	"median": MEDIAN,
+}
+
+func (fn Aggregation) String() string {
+	for name, v := range Aggregations {
+		if v == fn {
+			return name
+		}
+	}
+	return "unknown"
 }
 
 type Fetcher struct {
+	// Breakdown keeps a series of aggregates per category
+	// or per tracker along with the total.
+	Breakdown Dimension
+	// Fn aggregates the quantities of each period, sum by default.
+	Fn Aggregation
+	// From and To bound the fetched periods, they default to
+	// the frequency periods preceding now.
+	From, To time.Time
+	// Location is the time zone of the periods, the zone of the
+	// first tracker by default. Trackers bucket their records in
+	// their own zone, on the wall clock of the periods.
+	Location *time.Location
+	// Calendar sets where weeks and years begin for every
+	// tracker, the calendar of the first tracker by default.
+	Calendar *Calendar
+	// Tags restricts the records to the ones carrying any of
+	// them, tags are resolved in each tracker regardless of case.
+	Tags []string
+
 	frequency  int
 	period     Period
-	categories []int
+	from, to   time.Time
+	categories []string
 	catnames   []string
+	warnings   []string
 	trackers   []string
 	periodKeys []string
-	data       map[string]int64
+	data       map[string]*stats
+	series     map[string]map[string]*stats
+	seriesKeys []string
+	meta       *Metadata
+	mixedMeta  bool
 	resc       chan result
 	catnamec   chan string
 	quit       chan struct{}
 }
 
-func NewFetcher(freq int, period Period, categories []int, trackers []string) *Fetcher {
+// NewFetcher returns a Fetcher of the trackers records, categories
+// are referenced by id or name and resolved in each tracker.
+func NewFetcher(freq int, period Period, categories []string, trackers []string) *Fetcher {
 	return &Fetcher{
 		frequency:  freq,
 		categories: categories,
 		period:     period,
 		trackers:   trackers,
-		periodKeys: make([]string, freq+1),
-		data:       make(map[string]int64),
+		periodKeys: make([]string, 0),
+		data:       make(map[string]*stats),
+		series:     make(map[string]map[string]*stats),
 		resc:       make(chan result, len(trackers)),
 		catnamec:   make(chan string, len(categories)),
 		quit:       make(chan struct{}, 1),
@@ -54,6 +116,27 @@ func (f *Fetcher) fetch() {
 		f.quit <- struct{}{}
 	}()
 
+	names, err := f.categoryNames()
+	if err != nil {
+		f.resc <- result{err: err}
+		return
+	}
+
+	if (f.Location == nil || f.Calendar == nil) && len(f.trackers) > 0 {
+		// trackers failing to open report it along with their results
+		withDBContext(f.trackers[0], func(db *DB) error {
+			if f.Location == nil {
+				f.Location = db.loc
+			}
+			if f.Calendar == nil {
+				f.Calendar = &db.cal
+			}
+			return nil
+		})
+	}
+
+	from, to := f.bounds()
+
 	var wg sync.WaitGroup
 	wg.Add(len(f.trackers) + 1)
 
@@ -67,141 +150,533 @@ func (f *Fetcher) fetch() {
 		go func(dbname string) {
 			defer wg.Done()
 
-			var res []timeData
+			var (
+				res      []timeData
+				warnings []string
+				meta     Metadata
+			)
 			err := withDBContext(dbname, func(db *DB) error {
-				var cerr error
-				var name string
+				var (
+					name       string
+					categories []int
+					err        error
+				)
+
+				if meta, err = db.getMetadata(); err != nil {
+					return err
+				}
+
+				for _, n := range names {
+					category, cerr := db.resolveCategory(n)
+					if _, ok := cerr.(*ErrUnknownCategory); ok {
+						warnings = append(warnings, fmt.Sprintf("tracker %s has no category %q, skipped.", dbname, n))
+						continue
+					} else if cerr != nil {
+						return cerr
+					}
 
-				for _, category := range f.categories {
 					name, cerr = db.getCategory(category)
 					if cerr != nil {
 						return cerr
 					}
 					f.catnamec <- name
+
+					categories = append(categories, category)
+				}
+
+				// none of the categories exist in this tracker
+				if len(names) > 0 && len(categories) == 0 {
+					return nil
+				}
+
+				tags, missing, cerr := db.resolveTags(f.Tags)
+				if cerr != nil {
+					return cerr
+				}
+				for _, t := range missing {
+					warnings = append(warnings, fmt.Sprintf("tracker %s has no tag %q, skipped.", dbname, t))
 				}
 
-				switch f.period {
-				case DAY:
-					res, cerr = db.queryDay(f.frequency, f.categories)
-				case WEEK:
-					res, cerr = db.queryWeek(f.frequency, f.categories)
-				case MONTH:
-					res, cerr = db.queryMonth(f.frequency, f.categories)
-				case YEAR:
-					res, cerr = db.queryYear(f.frequency, f.categories)
+				// none of the tags exist in this tracker
+				if len(f.Tags) > 0 && len(tags) == 0 {
+					return nil
 				}
+
+				db.cal = f.calendar()
+				res, cerr = db.queryPeriod(f.period, from, to, categories, tags)
 				return cerr
 			})
-			f.resc <- result{err: err, values: res}
+			f.resc <- result{err: err, tracker: dbname, values: res, warnings: warnings, meta: meta}
 		}(tracker)
 	}
 
 	wg.Wait()
 }
 
+// categoryNames returns the names of the fetched categories.
+// IDs differ from one tracker to another, categories given by
+// id are named after their category in the first tracker.
+func (f *Fetcher) categoryNames() ([]string, error) {
+	names := make([]string, len(f.categories))
+	copy(names, f.categories)
+
+	if len(f.trackers) == 0 {
+		return names, nil
+	}
+
+	for i, ref := range names {
+		id, err := strconv.Atoi(ref)
+		if err != nil {
+			continue
+		}
+
+		if err = withDBContext(f.trackers[0], func(db *DB) error {
+			var cerr error
+
+			names[i], cerr = db.getCategory(id)
+			return cerr
+		}); err != nil {
+			return names, err
+		}
+	}
+	return names, nil
+}
+
+// bounds returns the beginning of the first fetched period
+// and the end of the last fetched day.
+func (f *Fetcher) bounds() (time.Time, time.Time) {
+	if !f.to.IsZero() {
+		return f.from, f.to
+	}
+
+	loc := f.Location
+	if loc == nil {
+		// an invalid default zone fails the trackers on open
+		loc = time.Local
+		if l, err := defaultLocation(); err == nil {
+			loc = l
+		}
+	}
+
+	to := inLocation(f.To, loc)
+	if f.To.IsZero() {
+		to = time.Now().In(loc)
+	}
+	f.to = midnight(to).AddDate(0, 0, 1).Add(-time.Nanosecond)
+	if f.period.unit == HOURS && f.To.IsZero() {
+		// hours end with the period in progress rather than the day
+		start := timeData{date: to, period: f.period, cal: f.calendar()}.Start()
+		f.to = time.Date(start.Year(), start.Month(), start.Day(), start.Hour()+f.period.units(), 0, 0, 0,
+			start.Location()).Add(-time.Nanosecond)
+	}
+
+	first := timeData{date: inLocation(f.From, loc), period: f.period, cal: f.calendar()}
+	if f.From.IsZero() {
+		first.date = timeData{date: f.to, period: f.period, cal: f.calendar()}.Start()
+		for i := 0; i < f.frequency; i++ {
+			first = first.Prev()
+		}
+	}
+	f.from = first.Start()
+
+	return f.from, f.to
+}
+
+// calendar returns the calendar of the periods, iso weeks and calendar years by default.
+func (f *Fetcher) calendar() Calendar {
+	if f.Calendar == nil {
+		return Calendar{}
+	}
+	return *f.Calendar
+}
+
+// setKeys sets the keys of the fetched periods in order. Keys
+// are made of the wall clock start of the periods, as the dates
+// of the query results are, whatever the zone of the bounds.
 func (f *Fetcher) setKeys(wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	tdata := timeData{date: time.Now(), period: f.period}
+	from, to := f.bounds()
 
-	for i := f.frequency; i >= 0; i-- {
-		f.periodKeys[i] = tdata.Key()
-		tdata = tdata.Prev()
+	var keys []string
+	tdata := timeData{date: to, period: f.period, cal: f.calendar()}
+	for tdata.date = tdata.Start(); !tdata.date.Before(from); tdata = tdata.Prev() {
+		// hours repeat when clocks are set back
+		if key := tdata.Key(); len(keys) == 0 || keys[0] != key {
+			keys = append([]string{key}, keys...)
+		}
 	}
+	f.periodKeys = keys
 }
 
 func (f *Fetcher) Exec() (err error) {
 	go f.fetch()
 
-out:
-	for {
-		select {
-		case res := <-f.resc:
-			if res.err != nil {
-				if err == nil {
-					err = res.err
-				}
-				continue
+	if f.Breakdown == TRACKER {
+		for _, tracker := range f.trackers {
+			f.addSeries(tracker)
+		}
+	}
+
+	collect := func(res result) {
+		f.warnings = append(f.warnings, res.warnings...)
+		if res.err != nil {
+			if err == nil {
+				err = res.err
 			}
+			return
+		}
+		f.addMetadata(res.meta)
+
+		for _, data := range res.values {
+			mergeStats(f.data, data.Key(), data.stats)
 
-			for _, data := range res.values {
-				f.data[data.Key()] += data.Quantity()
+			switch f.Breakdown {
+			case CATEGORY:
+				mergeStats(f.series[f.addSeries(data.category)], data.Key(), data.stats)
+			case TRACKER:
+				mergeStats(f.series[f.addSeries(res.tracker)], data.Key(), data.stats)
 			}
+		}
+	}
+
+	for {
+		select {
+		case res := <-f.resc:
+			collect(res)
 		case name := <-f.catnamec:
-			f.catnames = append(f.catnames, name)
+			f.addCatName(name)
 		case <-f.quit:
-			break out
+			// every tracker is done once quit is received,
+			// their last results may still be buffered.
+			for len(f.resc) > 0 {
+				collect(<-f.resc)
+			}
+			for len(f.catnamec) > 0 {
+				f.addCatName(<-f.catnamec)
+			}
+			return
 		}
 	}
-	return
 }
 
+// addMetadata adds the metadata of a tracker, trackers
+// of different metadata are formatted as is.
+func (f *Fetcher) addMetadata(meta Metadata) {
+	if f.meta == nil {
+		f.meta = &meta
+	} else if *f.meta != meta {
+		f.mixedMeta = true
+	}
+}
+
+// Format formats an aggregate in the unit of the trackers,
+// counts are formatted as is.
+func (f *Fetcher) Format(v float64) string {
+	if f.Fn == COUNT || f.meta == nil || f.mixedMeta {
+		return newMetadata().format(v)
+	}
+	return f.meta.format(v)
+}
+
+// addCatName adds name to the fetched category names,
+// unless a tracker already reported it.
+func (f *Fetcher) addCatName(name string) {
+	for _, n := range f.catnames {
+		if strings.EqualFold(n, name) {
+			return
+		}
+	}
+	f.catnames = append(f.catnames, name)
+}
+
+// addSeries adds a breakdown series unless a series of the
+// same name, regardless of case, exists. It returns the series key.
+func (f *Fetcher) addSeries(name string) string {
+	for _, k := range f.seriesKeys {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+
+	f.seriesKeys = append(f.seriesKeys, name)
+	f.series[name] = make(map[string]*stats)
+	return name
+}
+
+// Data returns the aggregate of each period, periods
+// without records are zero.
 func (f *Fetcher) Data() map[string]float64 {
+	return f.aggregate(f.data)
+}
+
+func (f *Fetcher) aggregate(data map[string]*stats) map[string]float64 {
 	rowsf := map[string]float64{}
-	for k, v := range f.data {
-		rowsf[k] = float64(v) / 100
+	for _, p := range f.points(data) {
+		rowsf[p.Key] = p.Value
 	}
 	return rowsf
 }
 
+// Points returns the aggregate of every period in order.
+func (f *Fetcher) Points() []Point {
+	return f.points(f.data)
+}
+
+// SeriesPoints returns the aggregates of a breakdown series
+// for every period in order.
+func (f *Fetcher) SeriesPoints(name string) []Point {
+	return f.points(f.series[name])
+}
+
+func (f *Fetcher) points(data map[string]*stats) []Point {
+	points := make([]Point, len(f.periodKeys))
+	for i, k := range f.periodKeys {
+		points[i].Key = k
+
+		if v, ok := data[k]; ok && v.count > 0 {
+			points[i].Value = v.value(f.Fn)
+		} else {
+			points[i].NoData = true
+		}
+	}
+	return points
+}
+
+// total aggregates the quantities of every period at once.
+func (f *Fetcher) total(data map[string]*stats) float64 {
+	var all stats
+	for _, v := range data {
+		all.merge(*v)
+	}
+	return all.value(f.Fn)
+}
+
+// Series returns the breakdown series names, trackers are kept
+// in the order they were given and categories sorted by name.
+func (f *Fetcher) Series() []string {
+	keys := make([]string, len(f.seriesKeys))
+	copy(keys, f.seriesKeys)
+
+	if f.Breakdown == CATEGORY {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// SeriesData returns the aggregates of a breakdown series by period.
+func (f *Fetcher) SeriesData(name string) map[string]float64 {
+	return f.aggregate(f.series[name])
+}
+
+// SeriesTotal returns the aggregate of a breakdown series over all periods.
+func (f *Fetcher) SeriesTotal(name string) float64 {
+	return f.total(f.series[name])
+}
+
+// CurrentKey returns the key of the period in progress,
+// empty when the fetched periods end before it.
+func (f *Fetcher) CurrentKey() string {
+	from, to := f.bounds()
+
+	now := time.Now().In(to.Location())
+	if now.Before(from) || now.After(to) {
+		return ""
+	}
+	return timeData{date: now, period: f.period, cal: f.calendar()}.Key()
+}
+
 func (f *Fetcher) PeriodKeys() []string {
 	return f.periodKeys
 }
 
-func (f *Fetcher) Sum() float64 {
-	var sum int64
-	for _, v := range f.data {
-		sum += v
-	}
-	return float64(sum) / 100
+// Total returns the aggregate over all periods.
+func (f *Fetcher) Total() float64 {
+	return f.total(f.data)
 }
 
 func (f *Fetcher) CatNames() []string {
 	return f.catnames
 }
 
+// Warnings returns the categories skipped in trackers lacking them.
+func (f *Fetcher) Warnings() []string {
+	return f.warnings
+}
+
+// Point is the aggregate of a fetched period, periods
+// without records have no data and a zero value.
+type Point struct {
+	Key    string
+	Value  float64
+	NoData bool
+}
+
 type result struct {
-	values []timeData
-	err    error
+	tracker  string
+	values   []timeData
+	warnings []string
+	meta     Metadata
+	err      error
 }
 
 type timeData struct {
-	qty    int64
-	date   time.Time
-	period Period
+	stats
+	date     time.Time
+	period   Period
+	cal      Calendar
+	category string
 }
 
 func (data timeData) Key() string {
-	switch data.period {
-	case DAY:
-		return fmt.Sprintf("%s %02d %s", data.date.Month().String(), data.date.Day(), data.date.Weekday().String())
-	case WEEK:
-		year, week := data.date.ISOWeek()
+	switch data.period.unit {
+	case HOURS:
+		return fmt.Sprintf("%d %s %02d %02d:00", data.date.Year(), data.date.Month().String(), data.date.Day(), data.date.Hour())
+	case DAYS:
+		return fmt.Sprintf("%d %s %02d %s", data.date.Year(), data.date.Month().String(), data.date.Day(),
+			data.date.Weekday().String())
+	case WEEKS:
+		year, week := data.cal.week(data.date)
 		return fmt.Sprintf("W%02d %d", week, year)
-	case MONTH:
+	case MONTHS:
 		return fmt.Sprintf("%d %s", data.date.Year(), data.date.Month().String())
-	case YEAR:
-		return fmt.Sprintf("%d", data.date.Year())
+	case QUARTERS:
+		year := data.cal.year(data.date)
+		months := (data.date.Year()-year)*12 + int(data.date.Month()-data.cal.YearStart())
+		return fmt.Sprintf("Q%d %s", months/3+1, data.cal.yearName(year))
+	case YEARS:
+		return data.cal.yearName(data.cal.year(data.date))
 	}
 	return "unknown"
 }
 
 func (data timeData) Quantity() int64 {
-	return data.qty
+	return data.sum
+}
+
+// Start returns the beginning of the period of data in its
+// calendar, periods of several units are counted from epoch.
+func (data timeData) Start() time.Time {
+	var (
+		date = data.date
+		loc  = date.Location()
+		n    = data.period.units()
+		cal  = data.cal
+	)
+
+	switch data.period.unit {
+	case HOURS:
+		hours := daysSinceEpoch(date)*24 + date.Hour()
+		hours -= hours % n
+		return time.Date(epoch.Year(), epoch.Month(), epoch.Day()+hours/24, hours%24, 0, 0, 0, loc)
+	case DAYS:
+		days := daysSinceEpoch(date)
+		return time.Date(epoch.Year(), epoch.Month(), epoch.Day()+days-days%n, 0, 0, 0, 0, loc)
+	case WEEKS:
+		// epoch is a monday, as iso weeks start on monday
+		days := daysSinceEpoch(date) + cal.weekShift
+		return time.Date(epoch.Year(), epoch.Month(), epoch.Day()+days-days%(7*n)-cal.weekShift, 0, 0, 0, 0, loc)
+	case MONTHS, QUARTERS:
+		months := date.Year()*12 + int(date.Month()) - 1 - cal.yearShift
+		months -= months % n
+		months += cal.yearShift
+		return time.Date(months/12, time.Month(months%12+1), 1, 0, 0, 0, 0, loc)
+	case YEARS:
+		year := cal.year(date)
+		return time.Date(year-year%n, cal.YearStart(), 1, 0, 0, 0, 0, loc)
+	}
+	return date
 }
 
 func (data timeData) Prev() timeData {
-	prev := timeData{period: data.period}
-
-	switch data.period {
-	case DAY:
-		prev.date = data.date.AddDate(0, 0, -1)
-	case WEEK:
-		prev.date = data.date.AddDate(0, 0, -7)
-	case MONTH:
-		prev.date = data.date.AddDate(0, -1, 0)
-	case YEAR:
-		prev.date = data.date.AddDate(-1, 0, 0)
+	var (
+		prev = timeData{period: data.period, cal: data.cal}
+		n    = data.period.units()
+	)
+
+	switch data.period.unit {
+	case HOURS:
+		d := data.date
+		prev.date = time.Date(d.Year(), d.Month(), d.Day(), d.Hour()-n, d.Minute(), d.Second(), d.Nanosecond(), d.Location())
+	case DAYS:
+		prev.date = data.date.AddDate(0, 0, -n)
+	case WEEKS:
+		prev.date = data.date.AddDate(0, 0, -7*n)
+	case MONTHS, QUARTERS:
+		prev.date = data.date.AddDate(0, -n, 0)
+	case YEARS:
+		prev.date = data.date.AddDate(-n, 0, 0)
 	}
 	return prev
 }
+
+// stats summarizes quantities, the stats of distinct records
+// merge into the stats of their union.
+type stats struct {
+	sum    int64
+	count  int64
+	min    int64
+	max    int64
+	values []int64
+}
+
+func (s *stats) merge(o stats) {
+	if o.count == 0 {
+		return
+	}
+
+	if s.count == 0 || o.min < s.min {
+		s.min = o.min
+	}
+	if s.count == 0 || o.max > s.max {
+		s.max = o.max
+	}
+	s.sum += o.sum
+	s.count += o.count
+	s.values = append(s.values, o.values...)
+}
+
+// value returns the aggregate of the quantities, counts
+// aside quantities are stored in hundredths.
+func (s stats) value(fn Aggregation) float64 {
+	if s.count == 0 {
+		return 0
+	}
+
+	switch fn {
+	case AVG:
+		return float64(s.sum) / float64(s.count) / 100
+	case MIN:
+		return float64(s.min) / 100
+	case MAX:
+		return float64(s.max) / 100
+	case COUNT:
+		return float64(s.count)
+	case MEDIAN:
+		values := make([]int64, len(s.values))
+		copy(values, s.values)
+		sort.Sort(int64s(values))
+
+		mid := len(values) / 2
+		if len(values)%2 == 0 {
+			return float64(values[mid-1]+values[mid]) / 2 / 100
+		}
+		return float64(values[mid]) / 100
+	}
+	return float64(s.sum) / 100
+}
+
+func mergeStats(data map[string]*stats, key string, o stats) {
+	s, ok := data[key]
+	if !ok {
+		s = &stats{}
+		data[key] = s
+	}
+	s.merge(o)
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
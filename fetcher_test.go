@@ -9,7 +9,7 @@ import (
 )
 
 var (
-	testfetcher = NewFetcher(3, WEEK, []int{}, []string{"testf"})
+	testfetcher = NewFetcher(3, WEEK, []string{}, []string{"testf"})
 	tdata       = timeData{date: time.Now(), period: WEEK}
 )
 
@@ -22,10 +22,11 @@ func TestSetKeys(t *testing.T) {
 
 	assert.Equal(t, tdata.Key(), testfetcher.periodKeys[3])
 	assert.Equal(t, tdata.Prev().Key(), testfetcher.periodKeys[2])
+	assert.Equal(t, tdata.Key(), testfetcher.CurrentKey())
 }
 
 func TestFetchInvalid(t *testing.T) {
-	fetcher := NewFetcher(5, DAY, []int{}, []string{"foo", "bar"})
+	fetcher := NewFetcher(5, DAY, []string{}, []string{"foo", "bar"})
 	go fetcher.fetch()
 
 	assert.Equal(t, "all categories", <-fetcher.catnamec)
@@ -54,7 +55,7 @@ func TestFetchWithData(t *testing.T) {
 	err := populatedb()
 	assert.Nil(t, err)
 
-	testfetcher.categories = []int{1}
+	testfetcher.categories = []string{"Default"}
 	go testfetcher.fetch()
 
 	assert.Equal(t, "default", <-testfetcher.catnamec)
@@ -72,8 +73,8 @@ func TestFetchWithData(t *testing.T) {
 func TestExec(t *testing.T) {
 	err := testfetcher.Exec()
 	assert.Nil(t, err)
-	assert.Equal(t, 17020, testfetcher.data[tdata.Key()])
-	assert.Equal(t, 170.2, testfetcher.Sum())
+	assert.Equal(t, 17020, testfetcher.data[tdata.Key()].sum)
+	assert.Equal(t, 170.2, testfetcher.Total())
 	assert.Equal(t, "default", testfetcher.CatNames()[0])
 }
 
@@ -84,7 +85,7 @@ func populatedb() error {
 			if cerr != nil {
 				return
 			}
-			cerr = db.addRecord(qty, 1)
+			cerr = db.addRecord(qty, 1, time.Now())
 		}
 
 		add(1000)
@@ -94,3 +95,286 @@ func populatedb() error {
 	})
 	return err
 }
+
+func TestExecAcrossTrackers(t *testing.T) {
+	// ids are resolved in the first tracker
+	for category, name := range map[string]string{"BAZ": "BAZ", "4": "baz"} {
+		fetcher := NewFetcher(0, WEEK, []string{category}, []string{"test", "testf"})
+
+		err := fetcher.Exec()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1200), fetcher.data[tdata.Key()].sum)
+		assert.Equal(t, []string{"baz"}, fetcher.CatNames())
+		assert.Equal(t, []string{`tracker testf has no category "` + name + `", skipped.`}, fetcher.Warnings())
+	}
+
+	fetcher := NewFetcher(0, WEEK, []string{"default", "DEFAULT"}, []string{"test", "testf"})
+	assert.Nil(t, fetcher.Exec())
+	assert.Equal(t, []string{"default"}, fetcher.CatNames())
+	assert.Equal(t, 0, len(fetcher.Warnings()))
+}
+
+func TestExecBreakdown(t *testing.T) {
+	fetcher := NewFetcher(0, WEEK, []string{}, []string{"test", "testf"})
+	fetcher.Breakdown = TRACKER
+
+	assert.Nil(t, fetcher.Exec())
+	assert.Equal(t, []string{"test", "testf"}, fetcher.Series())
+	assert.Equal(t, 12.0, fetcher.SeriesData("test")[tdata.Key()])
+	assert.Equal(t, 170.2, fetcher.SeriesTotal("testf"))
+	assert.Equal(t, 182.2, fetcher.Total())
+
+	fetcher = NewFetcher(0, WEEK, []string{}, []string{"testf", "test"})
+	fetcher.Breakdown = CATEGORY
+
+	assert.Nil(t, fetcher.Exec())
+	assert.Equal(t, []string{"baz", "default"}, fetcher.Series())
+	assert.Equal(t, 12.0, fetcher.SeriesTotal("baz"))
+	assert.Equal(t, 170.2, fetcher.SeriesData("default")[tdata.Key()])
+	assert.Equal(t, 182.2, fetcher.Data()[tdata.Key()])
+}
+
+func TestExecAggregations(t *testing.T) {
+	expected := map[Aggregation]float64{
+		SUM:    182.2,
+		AVG:    45.55,
+		MIN:    5.2,
+		MAX:    155,
+		COUNT:  4,
+		MEDIAN: 11,
+	}
+
+	for fn, value := range expected {
+		fetcher := NewFetcher(0, WEEK, []string{}, []string{"test", "testf"})
+		fetcher.Fn = fn
+
+		assert.Nil(t, fetcher.Exec())
+		assert.InDelta(t, value, fetcher.Data()[tdata.Key()], 0.001, fn.String())
+		assert.InDelta(t, value, fetcher.Total(), 0.001, fn.String())
+	}
+}
+
+func TestStats(t *testing.T) {
+	var s stats
+	assert.Equal(t, 0.0, s.value(AVG))
+
+	s.merge(stats{sum: 300, count: 2, min: 100, max: 200, values: []int64{100, 200}})
+	s.merge(stats{})
+	s.merge(stats{sum: 50, count: 1, min: 50, max: 50, values: []int64{50}})
+
+	assert.Equal(t, 3.5, s.value(SUM))
+	assert.InDelta(t, 1.1666, s.value(AVG), 0.001)
+	assert.Equal(t, 0.5, s.value(MIN))
+	assert.Equal(t, 2.0, s.value(MAX))
+	assert.Equal(t, 3.0, s.value(COUNT))
+	assert.Equal(t, 1.0, s.value(MEDIAN))
+}
+
+func TestBounds(t *testing.T) {
+	fetcher := NewFetcher(2, MONTH, []string{}, []string{"testf"})
+	fetcher.To = time.Date(2015, time.March, 31, 0, 0, 0, 0, time.Local)
+
+	from, to := fetcher.bounds()
+	assert.Equal(t, time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local), from)
+	assert.Equal(t, time.Date(2015, time.March, 31, 23, 59, 59, 999999999, time.Local), to)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	fetcher.setKeys(&wg)
+	assert.Equal(t, []string{"2015 January", "2015 February", "2015 March"}, fetcher.PeriodKeys())
+	assert.Equal(t, "", fetcher.CurrentKey())
+
+	fetcher = NewFetcher(0, WEEK, []string{}, []string{"testf"})
+	fetcher.From = time.Date(2014, time.December, 31, 0, 0, 0, 0, time.Local)
+	fetcher.To = time.Date(2015, time.January, 14, 0, 0, 0, 0, time.Local)
+
+	from, _ = fetcher.bounds()
+	assert.Equal(t, time.Date(2014, time.December, 29, 0, 0, 0, 0, time.Local), from)
+
+	wg.Add(1)
+	fetcher.setKeys(&wg)
+	assert.Equal(t, []string{"W01 2015", "W02 2015", "W03 2015"}, fetcher.PeriodKeys())
+
+	// days of different years dont share keys
+	fetcher = NewFetcher(0, DAY, []string{}, []string{"testf"})
+	fetcher.From = time.Date(2014, time.October, 16, 0, 0, 0, 0, time.Local)
+	fetcher.To = time.Date(2015, time.October, 16, 0, 0, 0, 0, time.Local)
+
+	wg.Add(1)
+	fetcher.setKeys(&wg)
+	keys := fetcher.PeriodKeys()
+	assert.Equal(t, 366, len(keys))
+	assert.Equal(t, "2014 October 16 Thursday", keys[0])
+	assert.Equal(t, "2015 October 16 Friday", keys[365])
+
+	// hours end with the one in progress
+	fetcher = NewFetcher(3, HOUR, []string{}, []string{"testf"})
+	now := time.Now()
+
+	_, to = fetcher.bounds()
+	assert.True(t, to.After(now))
+	assert.True(t, to.Before(now.Add(time.Hour)))
+
+	wg.Add(1)
+	fetcher.setKeys(&wg)
+	assert.Equal(t, 4, len(fetcher.PeriodKeys()))
+	assert.Equal(t, fetcher.CurrentKey(), fetcher.PeriodKeys()[3])
+}
+
+func TestExecRange(t *testing.T) {
+	fetcher := NewFetcher(0, DAY, []string{}, []string{"testf"})
+	fetcher.From = time.Now().AddDate(0, 0, -3)
+	fetcher.To = time.Now().AddDate(0, 0, -1)
+
+	assert.Nil(t, fetcher.Exec())
+	assert.Equal(t, 3, len(fetcher.PeriodKeys()))
+	assert.Equal(t, 0.0, fetcher.Total())
+
+	fetcher = NewFetcher(0, DAY, []string{}, []string{"testf"})
+	fetcher.From = time.Now().AddDate(0, 0, -3)
+
+	assert.Nil(t, fetcher.Exec())
+	assert.Equal(t, 4, len(fetcher.PeriodKeys()))
+	assert.Equal(t, 170.2, fetcher.Total())
+}
+
+func TestExecPoints(t *testing.T) {
+	fetcher := NewFetcher(3, DAY, []string{}, []string{"testf"})
+	fetcher.Fn = AVG
+
+	assert.Nil(t, fetcher.Exec())
+
+	points := fetcher.Points()
+	assert.Equal(t, 4, len(points))
+	for i, p := range points {
+		assert.Equal(t, fetcher.PeriodKeys()[i], p.Key)
+	}
+	for _, p := range points[:3] {
+		assert.True(t, p.NoData, p.Key)
+		assert.Equal(t, 0.0, p.Value, p.Key)
+	}
+	assert.False(t, points[3].NoData)
+	assert.InDelta(t, 56.733, points[3].Value, 0.001)
+
+	data := fetcher.Data()
+	assert.Equal(t, 4, len(data))
+	assert.Equal(t, 0.0, data[points[0].Key])
+}
+
+func TestPeriodStart(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		loc = time.UTC
+	}
+
+	tests := []struct {
+		period   Period
+		date     time.Time
+		start    time.Time
+		key      string
+		prevKey  string
+		prevDate time.Time
+	}{
+		{DAY, time.Date(2015, time.January, 1, 13, 0, 0, 0, loc), time.Date(2015, time.January, 1, 0, 0, 0, 0, loc),
+			"2015 January 01 Thursday", "2014 December 31 Wednesday", time.Date(2014, time.December, 31, 0, 0, 0, 0, loc)},
+		{DAY, time.Date(2015, time.March, 8, 12, 0, 0, 0, loc), time.Date(2015, time.March, 8, 0, 0, 0, 0, loc),
+			"2015 March 08 Sunday", "2015 March 07 Saturday", time.Date(2015, time.March, 7, 0, 0, 0, 0, loc)},
+		{DAY, time.Date(2016, time.March, 1, 0, 0, 0, 0, loc), time.Date(2016, time.March, 1, 0, 0, 0, 0, loc),
+			"2016 March 01 Tuesday", "2016 February 29 Monday", time.Date(2016, time.February, 29, 0, 0, 0, 0, loc)},
+		{WEEK, time.Date(2015, time.January, 1, 0, 0, 0, 0, loc), time.Date(2014, time.December, 29, 0, 0, 0, 0, loc),
+			"W01 2015", "W52 2014", time.Date(2014, time.December, 22, 0, 0, 0, 0, loc)},
+		{WEEK, time.Date(2016, time.January, 3, 23, 0, 0, 0, loc), time.Date(2015, time.December, 28, 0, 0, 0, 0, loc),
+			"W53 2015", "W52 2015", time.Date(2015, time.December, 21, 0, 0, 0, 0, loc)},
+		{WEEK, time.Date(2015, time.March, 11, 0, 0, 0, 0, loc), time.Date(2015, time.March, 9, 0, 0, 0, 0, loc),
+			"W11 2015", "W10 2015", time.Date(2015, time.March, 2, 0, 0, 0, 0, loc)},
+		{MONTH, time.Date(2015, time.March, 31, 0, 0, 0, 0, loc), time.Date(2015, time.March, 1, 0, 0, 0, 0, loc),
+			"2015 March", "2015 February", time.Date(2015, time.February, 1, 0, 0, 0, 0, loc)},
+		{MONTH, time.Date(2015, time.January, 15, 0, 0, 0, 0, loc), time.Date(2015, time.January, 1, 0, 0, 0, 0, loc),
+			"2015 January", "2014 December", time.Date(2014, time.December, 1, 0, 0, 0, 0, loc)},
+		{YEAR, time.Date(2016, time.February, 29, 0, 0, 0, 0, loc), time.Date(2016, time.January, 1, 0, 0, 0, 0, loc),
+			"2016", "2015", time.Date(2015, time.January, 1, 0, 0, 0, 0, loc)},
+		{QUARTER, time.Date(2015, time.February, 14, 0, 0, 0, 0, loc), time.Date(2015, time.January, 1, 0, 0, 0, 0, loc),
+			"Q1 2015", "Q4 2014", time.Date(2014, time.October, 1, 0, 0, 0, 0, loc)},
+		{HOUR, time.Date(2015, time.January, 1, 0, 45, 0, 0, loc), time.Date(2015, time.January, 1, 0, 0, 0, 0, loc),
+			"2015 January 01 00:00", "2014 December 31 23:00", time.Date(2014, time.December, 31, 23, 0, 0, 0, loc)},
+		{HOUR, time.Date(2015, time.March, 8, 4, 30, 0, 0, loc), time.Date(2015, time.March, 8, 4, 0, 0, 0, loc),
+			"2015 March 08 04:00", "2015 March 08 03:00", time.Date(2015, time.March, 8, 3, 0, 0, 0, loc)},
+		{Period{HOURS, 6}, time.Date(2015, time.January, 1, 5, 0, 0, 0, loc), time.Date(2015, time.January, 1, 0, 0, 0, 0, loc),
+			"2015 January 01 00:00", "2014 December 31 18:00", time.Date(2014, time.December, 31, 18, 0, 0, 0, loc)},
+		{Period{DAYS, 14}, time.Date(2016, time.January, 10, 0, 0, 0, 0, loc), time.Date(2015, time.December, 28, 0, 0, 0, 0, loc),
+			"2015 December 28 Monday", "2015 December 14 Monday", time.Date(2015, time.December, 14, 0, 0, 0, 0, loc)},
+		{Period{MONTHS, 6}, time.Date(2015, time.May, 10, 0, 0, 0, 0, loc), time.Date(2015, time.January, 1, 0, 0, 0, 0, loc),
+			"2015 January", "2014 July", time.Date(2014, time.July, 1, 0, 0, 0, 0, loc)},
+	}
+
+	for _, test := range tests {
+		data := timeData{date: test.date, period: test.period}
+		data.date = data.Start()
+
+		assert.Equal(t, test.start, data.date, test.key)
+		assert.Equal(t, test.key, data.Key())
+		assert.Equal(t, test.prevKey, data.Prev().Key())
+		assert.Equal(t, test.prevDate, data.Prev().date, test.prevKey)
+	}
+}
+
+func TestCalendarStart(t *testing.T) {
+	var (
+		sunday = Calendar{weekShift: 1}
+		april  = Calendar{yearShift: 3}
+	)
+
+	tests := []struct {
+		period   Period
+		cal      Calendar
+		date     time.Time
+		start    time.Time
+		key      string
+		prevKey  string
+		prevDate time.Time
+	}{
+		{WEEK, sunday, time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2014, time.December, 28, 0, 0, 0, 0, time.UTC),
+			"W01 2015", "W52 2014", time.Date(2014, time.December, 21, 0, 0, 0, 0, time.UTC)},
+		{WEEK, sunday, time.Date(2015, time.March, 8, 0, 0, 0, 0, time.UTC), time.Date(2015, time.March, 8, 0, 0, 0, 0, time.UTC),
+			"W11 2015", "W10 2015", time.Date(2015, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{Period{WEEKS, 2}, sunday, time.Date(2015, time.January, 10, 0, 0, 0, 0, time.UTC), time.Date(2014, time.December, 28, 0, 0, 0, 0, time.UTC),
+			"W01 2015", "W51 2014", time.Date(2014, time.December, 14, 0, 0, 0, 0, time.UTC)},
+		{QUARTER, april, time.Date(2015, time.February, 14, 0, 0, 0, 0, time.UTC), time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+			"Q4 FY2014/15", "Q3 FY2014/15", time.Date(2014, time.October, 1, 0, 0, 0, 0, time.UTC)},
+		{QUARTER, april, time.Date(2015, time.April, 1, 0, 0, 0, 0, time.UTC), time.Date(2015, time.April, 1, 0, 0, 0, 0, time.UTC),
+			"Q1 FY2015/16", "Q4 FY2014/15", time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{YEAR, april, time.Date(2016, time.February, 29, 0, 0, 0, 0, time.UTC), time.Date(2015, time.April, 1, 0, 0, 0, 0, time.UTC),
+			"FY2015/16", "FY2014/15", time.Date(2014, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{Period{YEARS, 2}, april, time.Date(2017, time.March, 1, 0, 0, 0, 0, time.UTC), time.Date(2016, time.April, 1, 0, 0, 0, 0, time.UTC),
+			"FY2016/17", "FY2014/15", time.Date(2014, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{MONTH, april, time.Date(2015, time.March, 31, 0, 0, 0, 0, time.UTC), time.Date(2015, time.March, 1, 0, 0, 0, 0, time.UTC),
+			"2015 March", "2015 February", time.Date(2015, time.February, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		data := timeData{date: test.date, period: test.period, cal: test.cal}
+		data.date = data.Start()
+
+		assert.Equal(t, test.start, data.date, test.key)
+		assert.Equal(t, test.key, data.Key())
+		assert.Equal(t, test.prevKey, data.Prev().Key())
+		assert.Equal(t, test.prevDate, data.Prev().date, test.prevKey)
+	}
+}
+
+func TestExecCalendar(t *testing.T) {
+	setYearStart := func(month string) {
+		assert.Nil(t, withDBContext("testf", func(db *DB) error {
+			return db.setYearStart(month)
+		}))
+	}
+	setYearStart("april")
+	defer setYearStart("")
+
+	fetcher := NewFetcher(1, YEAR, []string{}, []string{"testf"})
+	assert.Nil(t, fetcher.Exec())
+
+	year := Calendar{yearShift: 3}.year(time.Now())
+	assert.Equal(t, Calendar{yearShift: 3}.yearName(year), fetcher.PeriodKeys()[1])
+	assert.Equal(t, 170.2, fetcher.Total())
+}
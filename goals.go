@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+var ErrInvalidGoalID = errors.New("goal doesnt exist.")
+
+type ErrInvalidGoal struct {
+	value string
+}
+
+func (err *ErrInvalidGoal) Error() string {
+	return fmt.Sprintf("invalid goal %q, expected <= or >= followed by a quantity, as in \"<= 400\".", err.value)
+}
+
+// Goal is a target of the sum of a category over a period, budgets
+// cap the sum while the other goals are reached by it.
+type Goal struct {
+	id int
+	// category is 0 for the goals of the whole tracker.
+	category int
+	catname  string
+	period   Period
+	budget   bool
+	target   int64
+}
+
+// goalOperators are tried in order, operators come
+// before those they start with, as <= before <.
+var goalOperators = []struct {
+	op     string
+	budget bool
+}{
+	{"<=", true},
+	{"≤", true},
+	{">=", false},
+	{"≥", false},
+}
+
+// parseGoal parses an operator, <= for budgets and >= for the other
+// goals, followed by a quantity in the unit of the tracker.
+func parseGoal(s string, meta Metadata) (budget bool, target int64, err error) {
+	var (
+		qty = strings.TrimSpace(s)
+		ok  bool
+	)
+
+	for _, op := range goalOperators {
+		if strings.HasPrefix(qty, op.op) {
+			qty, budget, ok = qty[len(op.op):], op.budget, true
+			break
+		}
+	}
+	if !ok {
+		return false, 0, &ErrInvalidGoal{s}
+	}
+
+	if target, err = meta.parseQuantity(qty); err != nil {
+		return false, 0, err
+	}
+	if target < 0 {
+		return false, 0, &ErrInvalidGoal{s}
+	}
+	return budget, target, nil
+}
+
+// reached reports whether sum meets the goal, budgets are
+// met as long as sum doesnt exceed them.
+func (g Goal) reached(sum float64) bool {
+	target := float64(g.target) / 100
+	if g.budget {
+		return sum <= target
+	}
+	return sum >= target
+}
+
+// mark returns the marker of the aggregates of the goal.
+func (g Goal) mark(sum float64) string {
+	if g.reached(sum) {
+		return "✓"
+	}
+	return "✗"
+}
+
+// markCurrent returns the marker of the period in progress, empty
+// until the sum settles the goal, as it is reached or a budget exceeded.
+func (g Goal) markCurrent(sum float64) string {
+	if g.reached(sum) == g.budget {
+		return ""
+	}
+	return g.mark(sum)
+}
+
+// describe lays out the goal, as in ≤ 400 EUR per month.
+func (g Goal) describe(meta Metadata) string {
+	op := "≥"
+	if g.budget {
+		op = "≤"
+	}
+	return fmt.Sprintf("%s %s per %s", op, meta.format(float64(g.target)/100), g.period)
+}
+
+// status tells how far sum is from the goal.
+func (g Goal) status(sum float64, meta Metadata) string {
+	// in hundredths, as float differences arent exact
+	left := float64(g.target-int64(math.Round(sum*100))) / 100
+
+	switch {
+	case g.budget && left >= 0:
+		return meta.format(left) + " left"
+	case g.budget:
+		return meta.format(-left) + " over"
+	case left > 0:
+		return meta.format(left) + " to go"
+	}
+	return "reached"
+}
+
+// setGoal sets the goal of category over period, replacing
+// the former one. Category 0 sets the goal of the whole tracker.
+func (db *DB) setGoal(category int, period Period, budget bool, target int64) error {
+	if category != 0 {
+		if _, err := db.getCategory(category); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec("insert or replace into goals(category, period, budget, target) values(?, ?, ?, ?)",
+		category, period.String(), budget, target)
+	return err
+}
+
+func (db *DB) deleteGoal(id int) error {
+	res, err := db.Exec("delete from goals where id = ?", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, ErrInvalidGoalID)
+}
+
+func (db *DB) scanGoals(qry *query) ([]Goal, error) {
+	var (
+		g      Goal
+		period string
+		res    []Goal
+	)
+
+	rows, err := db.Query(qry.String(), qry.Args()...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = rows.Scan(&g.id, &g.category, &g.catname, &period, &g.budget, &g.target)
+		if err != nil {
+			return res, err
+		}
+
+		if g.period, err = parsePeriod(period); err != nil {
+			return res, err
+		}
+		res = append(res, g)
+	}
+	return res, rows.Err()
+}
+
+func (db *DB) goalsQuery() *query {
+	return newQuery("goals left join categories on categories.id = goals.category",
+		"goals.id", "goals.category", "coalesce(categories.name, '')", "goals.period",
+		"goals.budget", "goals.target").
+		order("goals.category, goals.id")
+}
+
+func (db *DB) getGoals() ([]Goal, error) {
+	return db.scanGoals(db.goalsQuery())
+}
+
+// goalOf returns the goal of the aggregates of categories over
+// period, nil when there is none. Only the goals of the whole tracker
+// or of a single category apply.
+func (db *DB) goalOf(categories []int, period Period) (*Goal, error) {
+	if len(categories) > 1 {
+		return nil, nil
+	}
+
+	category := 0
+	if len(categories) == 1 {
+		category = categories[0]
+	}
+
+	goals, err := db.scanGoals(db.goalsQuery().
+		where("goals.category = ?", category).
+		where("goals.period = ?", period.String()))
+	if err != nil || len(goals) == 0 {
+		return nil, err
+	}
+	return &goals[0], nil
+}
+
+// progress returns the sum of the goal over its period holding now.
+func (db *DB) progress(g Goal, now time.Time) (float64, error) {
+	var categories []int
+	if g.category != 0 {
+		categories = append(categories, g.category)
+	}
+
+	now = now.In(db.loc)
+	start := timeData{date: now, period: g.period, cal: db.cal}.Start()
+
+	datas, err := db.queryPeriod(g.period, start, now, categories, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum int64
+	for _, data := range datas {
+		sum += data.Quantity()
+	}
+	return float64(sum) / 100, nil
+}
+
+// Goal returns the goal of the aggregates, nil unless they sum the
+// records of a single tracker, all of them or those of a category.
+func (f *Fetcher) Goal() (*Goal, error) {
+	if len(f.trackers) != 1 || f.Fn != SUM || len(f.Tags) > 0 {
+		return nil, nil
+	}
+
+	var goal *Goal
+	err := withDBContext(f.trackers[0], func(db *DB) error {
+		categories, err := db.resolveCategories(f.categories)
+		if _, ok := err.(*ErrUnknownCategory); ok {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		goal, err = db.goalOf(categories, f.period)
+		return err
+	})
+	return goal, err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGoal(t *testing.T) {
+	meta := Metadata{Unit: "km", Precision: 1}
+
+	budget, target, err := parseGoal("<= 400", newMetadata())
+	assert.Nil(t, err)
+	assert.True(t, budget)
+	assert.Equal(t, int64(40000), target)
+
+	budget, target, err = parseGoal("≥150.5 km", meta)
+	assert.Nil(t, err)
+	assert.False(t, budget)
+	assert.Equal(t, int64(15050), target)
+
+	for _, s := range []string{"400", "< 400", "=> 400", ">= -5"} {
+		_, _, err = parseGoal(s, meta)
+		assert.Equal(t, &ErrInvalidGoal{s}, err, s)
+	}
+
+	_, _, err = parseGoal(">= lots", meta)
+	assert.IsType(t, &ErrInvalidQuantity{}, err)
+}
+
+func TestGoalStatus(t *testing.T) {
+	meta := Metadata{Unit: "EUR", Precision: 2}
+
+	budget := Goal{period: MONTH, budget: true, target: 40000}
+	assert.Equal(t, "≤ 400.00 EUR per month", budget.describe(meta))
+	assert.Equal(t, "✓", budget.mark(400))
+	assert.Equal(t, "150.00 EUR left", budget.status(250, meta))
+	assert.Equal(t, "1.8 left", budget.status(398.2, newMetadata()))
+	assert.Equal(t, "✗", budget.mark(410.5))
+	assert.Equal(t, "10.50 EUR over", budget.status(410.5, meta))
+
+	goal := Goal{period: Period{WEEKS, 2}, target: 15000}
+	assert.Equal(t, "≥ 150.00 EUR per 2 weeks", goal.describe(meta))
+	assert.Equal(t, "✗", goal.mark(100))
+	assert.Equal(t, "50.00 EUR to go", goal.status(100, meta))
+	assert.Equal(t, "reached", goal.status(150, meta))
+
+	// periods in progress are marked once the goal is settled
+	assert.Equal(t, "", goal.markCurrent(100))
+	assert.Equal(t, "✓", goal.markCurrent(150))
+	assert.Equal(t, "", budget.markCurrent(250))
+	assert.Equal(t, "✗", budget.markCurrent(410.5))
+}
+
+func TestGoals(t *testing.T) {
+	db := tempDB(t, "goals")
+
+	assert.Nil(t, db.addCategories("food", "rent"))
+	assert.Equal(t, ErrInvalidCategory, db.setGoal(42, MONTH, true, 100))
+	assert.Nil(t, db.setGoal(0, MONTH, true, 100000))
+	assert.Nil(t, db.setGoal(2, MONTH, true, 50000))
+	assert.Nil(t, db.setGoal(2, MONTH, true, 40000))
+	assert.Nil(t, db.setGoal(3, WEEK, false, 100))
+
+	goals, err := db.getGoals()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(goals))
+	assert.Equal(t, "food", goals[1].catname)
+	assert.Equal(t, int64(40000), goals[1].target)
+
+	goal, err := db.goalOf([]int{2}, MONTH)
+	assert.Nil(t, err)
+	assert.Equal(t, goals[1], *goal)
+
+	goal, err = db.goalOf([]int{}, MONTH)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, goal.category)
+
+	for _, categories := range [][]int{{2}, {2, 3}} {
+		goal, err = db.goalOf(categories, WEEK)
+		assert.Nil(t, err)
+		assert.Nil(t, goal)
+	}
+
+	now := time.Now()
+	assert.Nil(t, db.addRecord(25000, 2, now))
+	assert.Nil(t, db.addRecord(5000, 1, now))
+	assert.Nil(t, db.addRecord(9900, 2, timeData{date: now, period: MONTH}.Start().AddDate(0, 0, -1)))
+
+	sum, err := db.progress(goals[0], now)
+	assert.Nil(t, err)
+	assert.Equal(t, 300.0, sum)
+
+	sum, err = db.progress(goals[1], now)
+	assert.Nil(t, err)
+	assert.Equal(t, 250.0, sum)
+
+	assert.Nil(t, db.deleteGoal(goals[0].id))
+	assert.Equal(t, ErrInvalidGoalID, db.deleteGoal(goals[0].id))
+
+	// goals go along with their category
+	assert.Nil(t, db.deleteCategory(3))
+	goals, err = db.getGoals()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(goals))
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
+	"unicode/utf8"
 )
 
 var (
@@ -16,6 +16,9 @@ var (
 )
 
 type Graph struct {
+	// Format formats the values of the ordinate axis.
+	Format func(float64) string
+
 	height, width int
 
 	values []float64
@@ -27,6 +30,9 @@ type Graph struct {
 	points      map[string]float64
 	coordinates []coord
 
+	goal    float64
+	hasGoal bool
+
 	offset int
 }
 
@@ -35,14 +41,27 @@ type coord struct {
 	y int
 }
 
-func New(labels []string, points map[string]float64) *Graph {
+// New returns the graph of points by label. Labels without a point
+// are plotted at zero, but those of noData are left out of the plot.
+func New(labels []string, points map[string]float64, noData []string) *Graph {
 	g := &Graph{
 		labels:      labels,
 		values:      make([]float64, 0),
 		ord:         make(map[int]string),
 		abs:         make(map[int]float64),
 		coordinates: make([]coord, 0),
-		points:      points,
+		points:      make(map[string]float64),
+	}
+
+	skip := make(map[string]bool, len(noData))
+	for _, label := range noData {
+		skip[label] = true
+	}
+
+	for _, label := range labels {
+		if !skip[label] {
+			g.points[label] = points[label]
+		}
 	}
 
 	for _, val := range g.points {
@@ -54,6 +73,14 @@ func New(labels []string, points map[string]float64) *Graph {
 	return g
 }
 
+// SetGoal draws a line across the graph at the value of a goal.
+func (g *Graph) SetGoal(value float64) {
+	g.goal, g.hasGoal = value, true
+	if !contains(g.values, value) {
+		g.values = append(g.values, value)
+	}
+}
+
 func (g *Graph) Print() {
 	g.compute()
 
@@ -82,9 +109,9 @@ func (g *Graph) Print() {
 				line.WriteString("|")
 			} else if j == 0 {
 				if val, ok := g.abs[i]; ok {
-					sval := fmt.Sprintf("%v", val)
+					sval := g.label(val)
 
-					if diff := g.offset - len(sval); diff > 0 {
+					if diff := g.offset - utf8.RuneCountInString(sval); diff > 0 {
 						line.WriteString(strings.Repeat(" ", diff))
 					}
 					line.WriteString(sval)
@@ -93,6 +120,8 @@ func (g *Graph) Print() {
 				}
 			} else if g.hasPoint(j, i) {
 				line.WriteString("+")
+			} else if j > g.offset && g.isGoal(i) {
+				line.WriteString("-")
 			} else if j > g.offset {
 				line.WriteString(" ")
 			}
@@ -111,17 +140,19 @@ func (g *Graph) hasPoint(x, y int) bool {
 	return false
 }
 
+func (g *Graph) isGoal(y int) bool {
+	val, ok := g.abs[y]
+	return ok && g.hasGoal && val == g.goal
+}
+
 func (g *Graph) compute() {
 	if len(g.labels) == 0 || len(g.values) == 0 {
 		return
 	}
 
-	ch := make(chan struct{}, 1)
-
-	go g.computeAbs(ch)
+	// the offset of the ordinate reads the values computeAbs sorts
 	g.computeOrd()
-
-	<-ch
+	g.computeAbs()
 	g.addCoordinates()
 }
 
@@ -137,7 +168,7 @@ func (g *Graph) computeOrd() {
 	g.width -= marginX / 2
 }
 
-func (g *Graph) computeAbs(ch chan<- struct{}) {
+func (g *Graph) computeAbs() {
 	sort.Float64s(g.values)
 
 	max, min, topMargin := g.values[len(g.values)-1], g.values[0], marginY/2
@@ -171,23 +202,15 @@ func (g *Graph) computeAbs(ch chan<- struct{}) {
 		g.abs[g.height] = val
 	}
 	g.height += marginY
-
-	ch <- struct{}{}
 }
 
 func (g *Graph) addCoordinates() {
-	var wg sync.WaitGroup
-	wg.Add(len(g.points))
-
 	for label, value := range g.points {
-		go g.addCoordinate(label, value, &wg)
+		g.addCoordinate(label, value)
 	}
-	wg.Wait()
 }
 
-func (g *Graph) addCoordinate(label string, value float64, wg *sync.WaitGroup) {
-	defer wg.Done()
-
+func (g *Graph) addCoordinate(label string, value float64) {
 	var c coord
 	for pos, lab := range g.ord {
 		if lab == label {
@@ -204,12 +227,19 @@ func (g *Graph) addCoordinate(label string, value float64, wg *sync.WaitGroup) {
 
 func (g *Graph) setOffset() {
 	for _, value := range g.values {
-		if width := len(fmt.Sprintf("%v", value)); width > g.offset {
+		if width := utf8.RuneCountInString(g.label(value)); width > g.offset {
 			g.offset = width
 		}
 	}
 }
 
+func (g *Graph) label(value float64) string {
+	if g.Format != nil {
+		return g.Format(value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
 func contains(sl []float64, val float64) bool {
 	for _, v := range sl {
 		if v == val {
@@ -1,6 +1,7 @@
 package graph
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,7 +17,7 @@ func TestMain(m *testing.M) {
 		"3":    1000,
 		"4":    100,
 	}
-	graph = New(labels, points)
+	graph = New(labels, points, nil)
 
 	m.Run()
 }
@@ -34,9 +35,7 @@ func TestComputeOrd(t *testing.T) {
 }
 
 func TestComputeAbs(t *testing.T) {
-	ch := make(chan struct{}, 1)
-	graph.computeAbs(ch)
-	<-ch
+	graph.computeAbs()
 
 	assert.Equal(t, 100, graph.values[0])
 	assert.Equal(t, 1000, graph.abs[marginY/2])
@@ -51,3 +50,36 @@ func TestAddCoordinates(t *testing.T) {
 	x, y := graph.width-(marginX/2+1+marginX+1), marginY/2
 	assert.True(t, graph.hasPoint(x, y))
 }
+
+func TestNewDense(t *testing.T) {
+	g := New([]string{"1", "2", "3"}, map[string]float64{"1": 10, "3": 30}, nil)
+
+	assert.Equal(t, map[string]float64{"1": 10, "2": 0, "3": 30}, g.points)
+	assert.Equal(t, 3, len(g.values))
+
+	g = New([]string{"1", "2", "3"}, map[string]float64{"1": 10, "2": 0, "3": 30}, []string{"2"})
+	assert.Equal(t, map[string]float64{"1": 10, "3": 30}, g.points)
+	assert.Equal(t, 2, len(g.values))
+}
+
+func TestLabel(t *testing.T) {
+	g := New([]string{"1"}, map[string]float64{"1": 12.5}, nil)
+	assert.Equal(t, "12.5", g.label(12.5))
+
+	g.Format = func(v float64) string { return fmt.Sprintf("%.1f km", v) }
+	g.setOffset()
+	assert.Equal(t, "12.5 km", g.label(12.5))
+	assert.Equal(t, 7, g.offset)
+}
+
+func TestSetGoal(t *testing.T) {
+	g := New([]string{"1", "2"}, map[string]float64{"1": 10, "2": 30}, nil)
+	g.SetGoal(20)
+	g.SetGoal(20)
+	assert.Equal(t, 3, len(g.values))
+
+	g.compute()
+	for y, val := range g.abs {
+		assert.Equal(t, val == 20, g.isGoal(y))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var errDryRun = errors.New("dry run")
+
+// importFields are the fields of the records read from the columns
+// of an import, date and qty are required.
+var importFields = []string{"date", "qty", "category", "note"}
+
+type ErrImportFormat struct {
+	format string
+}
+
+func (err *ErrImportFormat) Error() string {
+	return fmt.Sprintf("unknown import format %q, expected csv.", err.format)
+}
+
+type ErrImportMapping struct {
+	value string
+}
+
+func (err *ErrImportMapping) Error() string {
+	return fmt.Sprintf("invalid column mapping %q, expected field=column with field one of %s.",
+		err.value, strings.Join(importFields, ", "))
+}
+
+type ErrImportColumn struct {
+	field, column string
+}
+
+func (err *ErrImportColumn) Error() string {
+	return fmt.Sprintf("no column %q for the %s of the records.", err.column, err.field)
+}
+
+// ErrImportRow reports the row an import failed on, rows are
+// numbered from the header. The whole import is rolled back.
+type ErrImportRow struct {
+	row int
+	err error
+}
+
+func (err *ErrImportRow) Error() string {
+	return fmt.Sprintf("row %d: %v", err.row, err.err)
+}
+
+// importKey identifies the records duplicated by an import.
+type importKey struct {
+	date     string
+	qty      int64
+	category int
+	note     string
+}
+
+// importReport sums up an import.
+type importReport struct {
+	records    int
+	duplicates int
+	categories []string
+}
+
+// parseMapping parses the field=column mappings of an import,
+// the fields left out are read from the columns named after them.
+func parseMapping(specs []string) (map[string]string, error) {
+	mapping := map[string]string{
+		"date":     "date",
+		"qty":      "qty",
+		"category": "category",
+		"note":     "note",
+	}
+
+	for _, spec := range specs {
+		i := strings.Index(spec, "=")
+		if i < 0 {
+			return nil, &ErrImportMapping{spec}
+		}
+
+		field, column := strings.ToLower(strings.TrimSpace(spec[:i])), strings.TrimSpace(spec[i+1:])
+		if _, ok := mapping[field]; !ok || column == "" {
+			return nil, &ErrImportMapping{spec}
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// csvColumns returns the index of the column of each field
+// in header, columns are matched regardless of case.
+func csvColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	columns := make(map[string]int)
+
+	for _, field := range importFields {
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), mapping[field]) {
+				columns[field] = i
+				break
+			}
+		}
+
+		if _, ok := columns[field]; !ok && (field == "date" || field == "qty") {
+			return nil, &ErrImportColumn{field, mapping[field]}
+		}
+	}
+	return columns, nil
+}
+
+// parseImportDate parses the date of an imported record, either
+// the way records are stored or the way they are added.
+func parseImportDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if date, err := parseWallClock(s, now.Location()); err == nil {
+		if !date.Before(midnight(now).AddDate(0, 0, 1)) {
+			return date, &ErrInvalidDate{s, "date is in the future"}
+		}
+		return date, nil
+	}
+	return parseRecordDate(s, now)
+}
+
+// importCSV adds the records of the csv read from r, whose first row
+// names the columns. Categories are created on first use and records
+// matching existing ones are skipped. Nothing is added on dry runs or
+// when a row is invalid.
+func (db *DB) importCSV(r io.Reader, mapping map[string]string, dryRun bool, now time.Time) (importReport, error) {
+	var report importReport
+
+	meta, err := db.getMetadata()
+	if err != nil {
+		return report, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return report, nil
+	} else if err != nil {
+		return report, &ErrImportRow{1, err}
+	}
+
+	columns, err := csvColumns(header, mapping)
+	if err != nil {
+		return report, err
+	}
+
+	categories, err := db.getCategories()
+	if err != nil {
+		return report, err
+	}
+
+	ids := make(map[string]int, len(categories))
+	for id, name := range categories {
+		ids[strings.ToLower(name)] = id
+	}
+
+	err = db.withTx(func(tx *sql.Tx) error {
+		var (
+			n        = 1
+			inserted = make(map[importKey]int)
+			matched  = make(map[importKey]int)
+		)
+
+		for {
+			row, err := reader.Read()
+			n++
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return &ErrImportRow{n, err}
+			}
+
+			field := func(name string) string {
+				if i, ok := columns[name]; ok && i < len(row) {
+					return strings.TrimSpace(row[i])
+				}
+				return ""
+			}
+
+			rec := record{category: defaultCategory, note: field("note")}
+			if rec.date, err = parseImportDate(field("date"), now.In(db.loc)); err != nil {
+				return &ErrImportRow{n, err}
+			}
+			if rec.qty, err = meta.parseQuantity(field("qty")); err != nil {
+				return &ErrImportRow{n, err}
+			}
+
+			if name := field("category"); name != "" {
+				id, ok := ids[strings.ToLower(name)]
+				if !ok {
+					res, err := tx.Exec("insert into categories(name) values(?)", name)
+					if err != nil {
+						return &ErrImportRow{n, err}
+					}
+
+					last, err := res.LastInsertId()
+					if err != nil {
+						return err
+					}
+					id = int(last)
+					ids[strings.ToLower(name)] = id
+					report.categories = append(report.categories, name)
+				}
+				rec.category = id
+			}
+
+			// records already in the tracker are skipped, as many
+			// times as they were added before the import.
+			var (
+				count int
+				key   = importKey{formatStoredDate(rec.date), rec.qty, rec.category, rec.note}
+			)
+			err = tx.QueryRow("select count(*) from records where date = ? and qty = ? and category = ? and note = ?",
+				key.date, key.qty, key.category, key.note).Scan(&count)
+			if err != nil {
+				return err
+			}
+
+			if count-inserted[key] > matched[key] {
+				matched[key]++
+				report.duplicates++
+				continue
+			}
+
+			if _, err = insertRecordTx(tx, rec); err != nil {
+				return &ErrImportRow{n, err}
+			}
+			inserted[key]++
+			report.records++
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return report, err
+}
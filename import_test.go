@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMapping(t *testing.T) {
+	mapping, err := parseMapping([]string{"qty=Amount", " Category = Type "})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"date": "date", "qty": "Amount", "category": "Type", "note": "note"}, mapping)
+
+	for _, spec := range []string{"qty", "tags=Labels", "date="} {
+		_, err = parseMapping([]string{spec})
+		assert.Equal(t, &ErrImportMapping{spec}, err, spec)
+	}
+
+	columns, err := csvColumns([]string{"Day", "AMOUNT", "memo"}, map[string]string{
+		"date": "day", "qty": "amount", "category": "category", "note": "Memo"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"date": 0, "qty": 1, "note": 2}, columns)
+
+	_, err = csvColumns([]string{"date"}, map[string]string{"date": "date", "qty": "qty"})
+	assert.Equal(t, &ErrImportColumn{"qty", "qty"}, err)
+}
+
+func TestImportCSV(t *testing.T) {
+	db := tempDB(t, "import")
+
+	assert.Nil(t, db.addCategories("Food"))
+
+	var (
+		now     = time.Date(2015, time.March, 20, 12, 0, 0, 0, db.loc)
+		mapping = map[string]string{"date": "Day", "qty": "Amount", "category": "Type", "note": "Memo"}
+		csv     = "Day,Amount,Type,Memo\n" +
+			"2015-03-01,12.5,food,lunch\n" +
+			"2015-03-01 19:30,40,Rent,\n" +
+			"2015-03-02,3,,\"coffee, large\"\n" +
+			"2015-03-02,3,,\"coffee, large\"\n"
+	)
+
+	report, err := db.importCSV(strings.NewReader(csv), mapping, true, now)
+	assert.Nil(t, err)
+	assert.Equal(t, importReport{records: 4, categories: []string{"Rent"}}, report)
+
+	records, err := db.getRecords([]int{}, []int{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(records))
+	_, err = db.resolveCategory("rent")
+	assert.IsType(t, &ErrUnknownCategory{}, err)
+
+	report, err = db.importCSV(strings.NewReader(csv), mapping, false, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, report.records)
+
+	records, err = db.getRecords([]int{}, []int{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, "2015-03-01 19:30:00", formatDate(records[2].date))
+	assert.Equal(t, "Rent", records[2].catname)
+	assert.Equal(t, "coffee, large", records[0].note)
+	assert.Equal(t, "default", records[0].catname)
+
+	// importing the file again only adds the rows it gained
+	report, err = db.importCSV(strings.NewReader(csv+"2015-03-02,3,,\"coffee, large\"\n"), mapping, false, now)
+	assert.Nil(t, err)
+	assert.Equal(t, importReport{records: 1, duplicates: 4}, report)
+
+	// a bad row rolls the import back
+	bad := "Day,Amount\n2015-03-03,1\n2015-03-04,lots\n"
+	_, err = db.importCSV(strings.NewReader(bad), mapping, false, now)
+	assert.Equal(t, &ErrImportRow{3, &ErrInvalidQuantity{"lots", "expected a number"}}, err)
+
+	_, err = db.importCSV(strings.NewReader("Day,Amount\n2015-04-01,1\n"), mapping, false, now)
+	assert.Equal(t, &ErrImportRow{2, &ErrInvalidDate{"2015-04-01", "date is in the future"}}, err)
+
+	// so does a malformed one
+	for row, bad := range map[int]string{1: "Day,\"Amount\n", 3: "Day,Amount\n2015-03-03,1\n2015-03-04,1\"0\n"} {
+		_, err = db.importCSV(strings.NewReader(bad), mapping, false, now)
+		if assert.IsType(t, &ErrImportRow{}, err) {
+			assert.Equal(t, row, err.(*ErrImportRow).row)
+		}
+	}
+
+	records, err = db.getRecords([]int{}, []int{}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(records))
+}
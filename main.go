@@ -3,34 +3,44 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/user"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/klacabane/tracker/graph"
 )
 
 var (
-	TRACKER_DIR, DEFAULT_DB string
+	TRACKER_DIR string
+	DEFAULT_DB  = "default"
 )
 
 type UIComponent interface {
 	Print()
 }
 
-func init() {
-	u, err := user.Current()
-	if err != nil {
-		panic(err)
+func main() {
+	cfg, warnings := loadConfigs()
+	for _, warning := range warnings {
+		fmt.Println("WARNING:", warning)
 	}
+	DEFAULT_DB = cfg.get("tracker", DEFAULT_DB)
 
-	TRACKER_DIR = u.HomeDir + "/Dropbox/tracker/"
-	DEFAULT_DB = "default"
-}
-
-func main() {
 	app := cli.NewApp()
 	app.Name = "tracker"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "dir",
+			Usage:  "directory of the trackers",
+			EnvVar: "TRACKER_DIR",
+		},
+	}
+	// cli prints the errors of Before
+	app.Before = func(c *cli.Context) error {
+		return setTrackerDir(c.GlobalString("dir"), cfg)
+	}
 	app.Commands = []cli.Command{
 		// List
 		{
@@ -82,25 +92,40 @@ func main() {
 					Name:  "tracker, t",
 					Value: DEFAULT_DB,
 				},
-				cli.IntFlag{
+				cli.StringFlag{
 					Name:  "category, cat",
-					Value: 1,
+					Value: cfg.get("category", "1"),
+					Usage: "category id or name",
 				},
 				cli.StringFlag{
 					Name:  "period, p",
-					Value: "d",
+					Value: cfg.get("last.period", "d"),
+					Usage: periodUsage,
 				},
 			},
 			Action: func(c *cli.Context) {
 				var (
-					period = Periods[c.String("p")]
-					data   timeData
+					data timeData
+					meta Metadata
 				)
 
+				period, err := parsePeriod(c.String("p"))
+				if err != nil {
+					printErr(err)
+					return
+				}
+
 				if err := withDBContext(c.String("t"), func(db *DB) error {
-					var e error
+					category, e := db.resolveCategory(c.String("cat"))
+					if e != nil {
+						return e
+					}
 
-					data, e = db.queryLastRecord(c.Int("cat"), period)
+					if meta, e = db.getMetadata(); e != nil {
+						return e
+					}
+
+					data, e = db.queryLastRecord(category, period)
 					return e
 				}); err != nil {
 					printErr(err)
@@ -108,11 +133,102 @@ func main() {
 				}
 
 				table := NewTable(2)
+				table.Format = meta.format
 				table.Add(c.String("t"), "last")
 				table.Add(data.Key(), float64(data.Quantity())/100)
 				table.Print()
 			},
 		},
+		// Stats
+		{
+			Name:  "stats",
+			Usage: "Shows the streaks of periods with records, or meeting their goal, per category",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+				cli.StringSliceFlag{
+					Name:  "categories, cat",
+					Value: &cli.StringSlice{},
+					Usage: "category ids or names, the categories with records by default",
+				},
+				cli.StringFlag{
+					Name:  "period, p",
+					Value: cfg.get("stats.period", "d"),
+					Usage: periodUsage,
+				},
+			},
+			Action: func(c *cli.Context) {
+				period, err := parsePeriod(c.String("p"))
+				if err != nil {
+					printErr(err)
+					return
+				}
+
+				if err := withDBContext(c.String("t"), func(db *DB) error {
+					categories, err := db.resolveCategories(c.StringSlice("cat"))
+					if err != nil {
+						return err
+					}
+
+					if len(categories) == 0 {
+						all, err := db.getCategories()
+						if err != nil {
+							return err
+						}
+						for id := range all {
+							categories = append(categories, id)
+						}
+						sort.Ints(categories)
+					}
+
+					meta, err := db.getMetadata()
+					if err != nil {
+						return err
+					}
+
+					var (
+						now  = time.Now()
+						seen = make(map[int]bool)
+					)
+					table := NewTableNamedCols("category", "current streak", "longest streak",
+						"last entry", "days since", "entries", "frequency")
+					table.Title = c.String("t") + " per " + period.String()
+					for _, category := range categories {
+						if seen[category] {
+							continue
+						}
+						seen[category] = true
+
+						h, err := db.habitStats(category, period, now)
+						if err != nil {
+							return err
+						}
+
+						if h.entries == 0 {
+							if !c.IsSet("cat") {
+								continue
+							}
+							table.Add(h.catname, span(period, 0), span(period, 0), "-", "-", 0, "-")
+							continue
+						}
+
+						catname := h.catname
+						if h.goal != nil {
+							catname += " (" + h.goal.describe(meta) + ")"
+						}
+						table.Add(catname, span(period, h.current), span(period, h.longest),
+							formatDate(h.last), h.daysSince(now), h.entries,
+							fmt.Sprintf("%.2f per %s", h.frequency(), period))
+					}
+					table.Print()
+					return nil
+				}); err != nil {
+					printErr(err)
+				}
+			},
+		},
 		// Add
 		{
 			Name: "add",
@@ -121,45 +237,145 @@ func main() {
 					Name:  "tracker, t",
 					Value: DEFAULT_DB,
 				},
-				cli.Float64Flag{
+				cli.StringFlag{
 					Name:  "quantity, qty",
-					Value: 0,
+					Usage: "quantity, optionally followed by the tracker unit",
 				},
-				cli.IntFlag{
+				cli.StringFlag{
 					Name:  "category, cat",
-					Value: 1,
+					Value: cfg.get("category", "1"),
+					Usage: "category id or name",
+				},
+				cli.StringFlag{
+					Name:  "date, d",
+					Usage: "2006-01-02, today, yesterday or -Nd/w/m/y, optionally followed by 15:04, now by default",
+				},
+				cli.StringFlag{
+					Name:  "note, n",
+					Usage: "what the record was",
+				},
+				cli.StringSliceFlag{
+					Name:  "tag",
+					Value: &cli.StringSlice{},
+					Usage: "tag of the record, repeat it for several tags",
 				},
 			},
 			Action: func(c *cli.Context) {
-				var (
-					category int
-					quantity int64
-				)
-
-				if qtyf := c.Float64("qty"); qtyf == 0 {
+				if c.String("qty") == "" {
 					fmt.Println("no quantity specified.")
 					return
-				} else {
-					quantity = int64(qtyf * 100)
 				}
 
 				if err := withDBContext(c.String("t"), func(db *DB) error {
-					if category = c.Int("cat"); category != 1 {
-						if _, cerr := db.getCategory(category); cerr != nil {
+					meta, cerr := db.getMetadata()
+					if cerr != nil {
+						return cerr
+					}
+
+					quantity, cerr := meta.parseQuantity(c.String("qty"))
+					if cerr != nil {
+						return cerr
+					}
+
+					// records added without date are added now
+					date := time.Now().In(db.loc)
+					if c.String("date") != "" {
+						if date, cerr = parseRecordDate(c.String("date"), date); cerr != nil {
 							return cerr
 						}
 					}
 
-					return db.addRecord(quantity, category)
+					category, cerr := db.resolveCategory(c.String("cat"))
+					if cerr != nil {
+						return cerr
+					}
+
+					_, cerr = db.insertRecord(record{
+						qty:      quantity,
+						category: category,
+						date:     date,
+						note:     c.String("note"),
+						tags:     c.StringSlice("tag"),
+					})
+					return cerr
 				}); err != nil {
 					printErr(err)
 				}
 			},
 		},
-		// Category
+		// Import
 		{
-			Name:      "category",
-			ShortName: "cat",
+			Name:  "import",
+			Usage: "import <file>, adds the records of a file whose first row names the columns, - reads stdin",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "csv",
+				},
+				cli.StringSliceFlag{
+					Name:  "map, m",
+					Value: &cli.StringSlice{},
+					Usage: "column of a field as in qty=Amount, fields are date, qty, category and note",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "checks the file without adding its records",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if c.String("format") != "csv" {
+					printErr(&ErrImportFormat{c.String("format")})
+					return
+				}
+
+				mapping, err := parseMapping(c.StringSlice("map"))
+				if err != nil {
+					printErr(err)
+					return
+				}
+
+				name := c.Args().First()
+				if name == "" {
+					fmt.Println("no file specified.")
+					return
+				}
+
+				file := os.Stdin
+				if name != "-" {
+					if file, err = os.Open(name); err != nil {
+						printErr(err)
+						return
+					}
+					defer file.Close()
+				}
+
+				var report importReport
+				if err = withDBContext(c.String("t"), func(db *DB) (err error) {
+					report, err = db.importCSV(file, mapping, c.Bool("dry-run"), time.Now())
+					return err
+				}); err != nil {
+					printErr(err)
+					return
+				}
+
+				verb := "imported"
+				if c.Bool("dry-run") {
+					verb = "would import"
+				}
+				fmt.Printf("%s %d records, %d duplicates skipped.\n", verb, report.records, report.duplicates)
+				if len(report.categories) > 0 {
+					fmt.Println("new categories:", strings.Join(report.categories, ", "))
+				}
+			},
+		},
+		// Records
+		{
+			Name:  "records",
+			Usage: "Lists, edits and removes records",
 			Subcommands: []cli.Command{
 				{
 					Name: "list",
@@ -168,18 +384,52 @@ func main() {
 							Name:  "tracker, t",
 							Value: DEFAULT_DB,
 						},
+						cli.StringSliceFlag{
+							Name:  "categories, cat",
+							Value: &cli.StringSlice{},
+							Usage: "category ids or names",
+						},
+						cli.StringSliceFlag{
+							Name:  "tag",
+							Value: &cli.StringSlice{},
+							Usage: "lists the records carrying any of the tags",
+						},
+						cli.IntFlag{
+							Name:  "limit, l",
+							Value: cfg.getInt("limit", 20),
+						},
 					},
 					Action: func(c *cli.Context) {
 						if err := withDBContext(c.String("t"), func(db *DB) error {
-							categories, cerr := db.getCategories()
-							if cerr != nil {
-								return cerr
+							categories, rerr := db.resolveCategories(c.StringSlice("cat"))
+							if rerr != nil {
+								return rerr
 							}
 
-							table := NewTable(2)
-							table.Title = "CATEGORIES"
-							for k, v := range categories {
-								table.Add(k, v)
+							tags, missing, rerr := db.resolveTags(c.StringSlice("tag"))
+							if rerr != nil {
+								return rerr
+							}
+							if len(missing) > 0 {
+								return &ErrUnknownTag{missing[0]}
+							}
+
+							records, rerr := db.getRecords(categories, tags, c.Int("limit"))
+							if rerr != nil {
+								return rerr
+							}
+
+							meta, rerr := db.getMetadata()
+							if rerr != nil {
+								return rerr
+							}
+
+							table := NewTableNamedCols("id", "date", "category", "quantity", "tags", "note")
+							table.Title = "RECORDS"
+							table.Format = meta.format
+							for _, r := range records {
+								table.Add(r.id, formatDate(r.date), r.catname, float64(r.qty)/100,
+									strings.Join(r.tags, ", "), r.note)
 							}
 							table.Print()
 
@@ -190,25 +440,81 @@ func main() {
 					},
 				},
 				{
-					Name: "add",
+					Name: "edit",
 					Flags: []cli.Flag{
 						cli.StringFlag{
 							Name:  "tracker, t",
 							Value: DEFAULT_DB,
 						},
-						cli.StringSliceFlag{
-							Name:  "categories, cat",
-							Value: &cli.StringSlice{},
+						cli.StringFlag{
+							Name:  "quantity, qty",
+							Usage: "quantity, optionally followed by the tracker unit",
+						},
+						cli.StringFlag{
+							Name:  "category, cat",
+							Usage: "category id or name",
+						},
+						cli.StringFlag{
+							Name: "date, d",
 						},
 					},
 					Action: func(c *cli.Context) {
-						if length := len(c.StringSlice("cat")); length == 0 {
-							fmt.Println("no categories specified.")
+						id, err := recordID(c)
+						if err != nil {
+							printErr(err)
 							return
 						}
 
-						if err := withDBContext(c.String("t"), func(db *DB) error {
-							return db.addCategories(c.StringSlice("cat")...)
+						if err = withDBContext(c.String("t"), func(db *DB) error {
+							r, rerr := db.getRecord(id)
+							if rerr != nil {
+								return rerr
+							}
+
+							if c.IsSet("qty") {
+								meta, rerr := db.getMetadata()
+								if rerr != nil {
+									return rerr
+								}
+
+								if r.qty, rerr = meta.parseQuantity(c.String("qty")); rerr != nil {
+									return rerr
+								}
+							}
+							if c.IsSet("cat") {
+								if r.category, rerr = db.resolveCategory(c.String("cat")); rerr != nil {
+									return rerr
+								}
+							}
+							if c.IsSet("date") {
+								if r.date, rerr = parseRecordDate(c.String("date"), time.Now().In(db.loc)); rerr != nil {
+									return rerr
+								}
+							}
+
+							return db.updateRecord(r.id, r.qty, r.category, r.date)
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+				{
+					Name: "rm",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+					},
+					Action: func(c *cli.Context) {
+						id, err := recordID(c)
+						if err != nil {
+							printErr(err)
+							return
+						}
+
+						if err = withDBContext(c.String("t"), func(db *DB) error {
+							return db.deleteRecord(id)
 						}); err != nil {
 							printErr(err)
 						}
@@ -216,50 +522,31 @@ func main() {
 				},
 			},
 		},
-		// aggregate
+		// Search
 		{
-			Name:      "aggregate",
-			ShortName: "agg",
+			Name:  "search",
+			Usage: "search <query>, finds the records whose note contains all the words of the query",
 			Flags: []cli.Flag{
 				cli.StringSliceFlag{
 					Name:  "trackers, t",
 					Value: &cli.StringSlice{},
 				},
-				cli.StringFlag{
-					Name:  "period, p",
-					Value: "w",
-				},
 				cli.IntFlag{
-					Name:  "frequency, f",
-					Value: 2,
-				},
-				cli.IntSliceFlag{
-					Name:  "categories, cat",
-					Value: &cli.IntSlice{},
-				},
-				cli.BoolFlag{
-					Name: "graph, g",
+					Name:  "limit, l",
+					Value: cfg.getInt("limit", 20),
 				},
 			},
 			Action: func(c *cli.Context) {
 				var (
-					period     = Periods[c.String("p")]
-					frequency  = c.Int("f")
-					categories = c.IntSlice("cat")
-					trackers   = c.StringSlice("t")
+					err      error
+					trackers = c.StringSlice("t")
 				)
 
-				if frequency < 0 {
-					frequency = 0
-				}
-
 				if len(trackers) == 0 {
 					trackers = append(trackers, DEFAULT_DB)
 				}
 
 				if len(trackers) == 1 && trackers[0] == "all" {
-					var err error
-
 					trackers, err = dblist()
 					if err != nil {
 						printErr(err)
@@ -267,38 +554,826 @@ func main() {
 					}
 				}
 
-				fetcher := NewFetcher(frequency, period,
-					categories, trackers)
-				if err := fetcher.Exec(); err != nil {
+				matches, err := search(trackers, strings.Join(c.Args(), " "), c.Int("limit"))
+				if err != nil {
 					printErr(err)
 					return
 				}
 
-				var (
-					component UIComponent
+				table := NewTableNamedCols("tracker", "date", "category", "quantity", "note")
+				table.Title = "RECORDS"
+				for _, m := range matches {
+					table.Add(m.tracker, formatDate(m.date), m.catname, m.meta.format(float64(m.qty)/100), m.note)
+				}
+				table.Print()
+			},
+		},
+		// Tags
+		{
+			Name:  "tags",
+			Usage: "Lists the tags of a tracker",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := withDBContext(c.String("t"), func(db *DB) error {
+					tags, err := db.getTags()
+					if err != nil {
+						return err
+					}
 
-					periodKeys = fetcher.PeriodKeys()
-					data       = fetcher.Data()
-				)
-				if c.Bool("graph") {
-					component = graph.New(periodKeys, data)
-				} else {
-					table := NewTable(2)
-					table.Add(strings.Join(trackers, " & "), strings.Join(fetcher.CatNames(), " & "))
+					table := NewTableNamedCols("tag", "records")
+					table.Title = "TAGS"
+					for _, t := range tags {
+						table.Add(t.name, t.records)
+					}
+					table.Print()
+					return nil
+				}); err != nil {
+					printErr(err)
+				}
+			},
+		},
+		// Timezone
+		{
+			Name:      "timezone",
+			ShortName: "tz",
+			Usage:     "Shows or sets the time zone a tracker reports in",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+				cli.BoolFlag{
+					Name:  "reset",
+					Usage: "report in TRACKER_TZ or the local time zone",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := withDBContext(c.String("t"), func(db *DB) error {
+					if c.Bool("reset") {
+						return db.setLocation("")
+					}
 
-					for _, k := range periodKeys {
-						table.Add(k, data[k])
+					if name := c.Args().First(); name != "" {
+						return db.setLocation(name)
 					}
-					table.Add("Total", fetcher.Sum())
 
-					component = table
+					fmt.Println(db.loc)
+					return nil
+				}); err != nil {
+					printErr(err)
 				}
-				component.Print()
 			},
 		},
-	}
-
-	app.Run(os.Args)
+		// Calendar
+		{
+			Name:  "calendar",
+			Usage: "Shows or sets where the weeks and years of a tracker begin",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+				cli.StringFlag{
+					Name:  "week",
+					Usage: "monday or sunday",
+				},
+				cli.StringFlag{
+					Name:  "year",
+					Usage: "month fiscal years begin, as in april or 4",
+				},
+				cli.BoolFlag{
+					Name:  "reset",
+					Usage: "iso weeks and calendar years",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := withDBContext(c.String("t"), func(db *DB) error {
+					if c.Bool("reset") {
+						if err := db.setWeekStart(""); err != nil {
+							return err
+						}
+						return db.setYearStart("")
+					}
+
+					if c.IsSet("week") {
+						if err := db.setWeekStart(c.String("week")); err != nil {
+							return err
+						}
+					}
+					if c.IsSet("year") {
+						if err := db.setYearStart(c.String("year")); err != nil {
+							return err
+						}
+					}
+
+					fmt.Println(db.cal)
+					return nil
+				}); err != nil {
+					printErr(err)
+				}
+			},
+		},
+		// Meta
+		{
+			Name:  "meta",
+			Usage: "Shows or sets the unit, description, precision and format of a tracker",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+				cli.StringFlag{
+					Name:  "unit",
+					Usage: "unit of the quantities, as in km, EUR or h",
+				},
+				cli.StringFlag{
+					Name: "description",
+				},
+				cli.StringFlag{
+					Name:  "precision",
+					Usage: "number of decimals of the quantities, at most 2",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "layout of the quantities, as in {qty} {unit}",
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := withDBContext(c.String("t"), func(db *DB) error {
+					for _, key := range metadataKeys {
+						if !c.IsSet(key) {
+							continue
+						}
+
+						if err := db.setMetadata(key, c.String(key)); err != nil {
+							return err
+						}
+					}
+
+					meta, err := db.getMetadata()
+					if err != nil {
+						return err
+					}
+
+					precision := ""
+					if meta.Precision >= 0 {
+						precision = strconv.Itoa(meta.Precision)
+					}
+
+					table := NewTable(2)
+					table.Title = c.String("t")
+					table.Add("unit", meta.Unit)
+					table.Add("description", meta.Description)
+					table.Add("precision", precision)
+					table.Add("format", meta.Format)
+					table.Print()
+					return nil
+				}); err != nil {
+					printErr(err)
+				}
+			},
+		},
+		// Goals
+		{
+			Name:  "goals",
+			Usage: "Shows the progress of the goals of a tracker over the current periods, sets and removes them",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tracker, t",
+					Value: DEFAULT_DB,
+				},
+			},
+			Action: func(c *cli.Context) {
+				if err := withDBContext(c.String("t"), func(db *DB) error {
+					meta, err := db.getMetadata()
+					if err != nil {
+						return err
+					}
+
+					goals, err := db.getGoals()
+					if err != nil {
+						return err
+					}
+
+					now := time.Now()
+					table := NewTableNamedCols("id", "category", "goal", "current", "progress", "status")
+					table.Title = "GOALS"
+					for _, g := range goals {
+						sum, err := db.progress(g, now)
+						if err != nil {
+							return err
+						}
+
+						catname, progress := g.catname, "-"
+						if g.category == 0 {
+							catname = "all categories"
+						}
+						if g.target > 0 {
+							progress = fmt.Sprintf("%.0f%%", sum*100/(float64(g.target)/100))
+						}
+
+						status := g.status(sum, meta)
+						if mark := g.markCurrent(sum); mark != "" {
+							status = mark + " " + status
+						}
+						table.Add(g.id, catname, g.describe(meta), meta.format(sum), progress, status)
+					}
+					table.Print()
+					return nil
+				}); err != nil {
+					printErr(err)
+				}
+			},
+			Subcommands: []cli.Command{
+				{
+					Name:  "set",
+					Usage: "set <goal>, <= for a budget or >= followed by a quantity, as in \"<= 400\"",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+						cli.StringFlag{
+							Name:  "category, cat",
+							Usage: "category id or name, the whole tracker by default",
+						},
+						cli.StringFlag{
+							Name:  "period, p",
+							Value: cfg.get("goals.period", "w"),
+							Usage: periodUsage,
+						},
+					},
+					Action: func(c *cli.Context) {
+						if !c.Args().Present() {
+							fmt.Println("no goal specified.")
+							return
+						}
+
+						if err := withDBContext(c.String("t"), func(db *DB) error {
+							meta, gerr := db.getMetadata()
+							if gerr != nil {
+								return gerr
+							}
+
+							period, gerr := parsePeriod(c.String("p"))
+							if gerr != nil {
+								return gerr
+							}
+
+							budget, target, gerr := parseGoal(strings.Join(c.Args(), " "), meta)
+							if gerr != nil {
+								return gerr
+							}
+
+							category := 0
+							if c.IsSet("cat") {
+								if category, gerr = db.resolveCategory(c.String("cat")); gerr != nil {
+									return gerr
+								}
+							}
+							return db.setGoal(category, period, budget, target)
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+				{
+					Name:  "rm",
+					Usage: "rm <id>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+					},
+					Action: func(c *cli.Context) {
+						id, err := strconv.Atoi(c.Args().First())
+						if err != nil {
+							printErr(ErrInvalidGoalID)
+							return
+						}
+
+						if err = withDBContext(c.String("t"), func(db *DB) error {
+							return db.deleteGoal(id)
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+			},
+		},
+		// Category
+		{
+			Name:      "category",
+			ShortName: "cat",
+			Subcommands: []cli.Command{
+				{
+					Name: "list",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+					},
+					Action: func(c *cli.Context) {
+						if err := withDBContext(c.String("t"), func(db *DB) error {
+							categories, cerr := db.getCategories()
+							if cerr != nil {
+								return cerr
+							}
+
+							table := NewTable(2)
+							table.Title = "CATEGORIES"
+							for k, v := range categories {
+								table.Add(k, v)
+							}
+							table.Print()
+
+							return nil
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+				{
+					Name: "add",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+						cli.StringSliceFlag{
+							Name:  "categories, cat",
+							Value: &cli.StringSlice{},
+						},
+					},
+					Action: func(c *cli.Context) {
+						if length := len(c.StringSlice("cat")); length == 0 {
+							fmt.Println("no categories specified.")
+							return
+						}
+
+						if err := withDBContext(c.String("t"), func(db *DB) error {
+							return db.addCategories(c.StringSlice("cat")...)
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+				{
+					Name:  "rename",
+					Usage: "rename <category> <name>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+					},
+					Action: func(c *cli.Context) {
+						name := c.Args().Get(1)
+						if name == "" {
+							fmt.Println("no name specified.")
+							return
+						}
+
+						if err := withDBContext(c.String("t"), func(db *DB) error {
+							id, cerr := db.resolveCategory(c.Args().First())
+							if cerr != nil {
+								return cerr
+							}
+
+							return db.renameCategory(id, name)
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+				{
+					Name:  "rm",
+					Usage: "rm <category>, records are reassigned to --into when given",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+						cli.StringFlag{
+							Name:  "into",
+							Usage: "category id or name",
+						},
+					},
+					Action: func(c *cli.Context) {
+						if err := withDBContext(c.String("t"), func(db *DB) error {
+							id, cerr := db.resolveCategory(c.Args().First())
+							if cerr != nil {
+								return cerr
+							}
+
+							if c.IsSet("into") {
+								into, cerr := db.resolveCategory(c.String("into"))
+								if cerr != nil {
+									return cerr
+								}
+								return db.mergeCategories(id, into)
+							}
+							return db.deleteCategory(id)
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+				{
+					Name:  "merge",
+					Usage: "merge <from> <into>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "tracker, t",
+							Value: DEFAULT_DB,
+						},
+					},
+					Action: func(c *cli.Context) {
+						if len(c.Args()) < 2 {
+							fmt.Println("no categories specified.")
+							return
+						}
+
+						if err := withDBContext(c.String("t"), func(db *DB) error {
+							ids, cerr := db.resolveCategories(c.Args()[:2])
+							if cerr != nil {
+								return cerr
+							}
+
+							return db.mergeCategories(ids[0], ids[1])
+						}); err != nil {
+							printErr(err)
+						}
+					},
+				},
+			},
+		},
+		// Config
+		{
+			Name:  "config",
+			Usage: "Lists, gets and sets the defaults of the commands",
+			Subcommands: []cli.Command{
+				{
+					Name: "list",
+					Action: func(c *cli.Context) {
+						table := NewTableNamedCols("key", "value", "usage")
+						table.Title = "CONFIG"
+						for _, k := range configKeys {
+							table.Add(k.name, cfg.get(k.name, ""), k.usage)
+						}
+						table.Print()
+					},
+				},
+				{
+					Name:  "get",
+					Usage: "tracker config get <key>",
+					Action: func(c *cli.Context) {
+						if _, err := lookupConfigKey(c.Args().First()); err != nil {
+							printErr(err)
+							return
+						}
+						fmt.Println(cfg.get(c.Args().First(), ""))
+					},
+				},
+				{
+					Name:  "set",
+					Usage: "tracker config set <key> <value>, an empty value unsets the key",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "local",
+							Usage: "sets the key in " + localConfig + " of the current directory",
+						},
+					},
+					Action: func(c *cli.Context) {
+						if len(c.Args()) != 2 {
+							fmt.Println("expected a key and a value.")
+							return
+						}
+
+						p := localConfig
+						if !c.Bool("local") {
+							var err error
+							if p, err = configPath(); err != nil {
+								printErr(err)
+								return
+							}
+						}
+
+						// the warnings of the file were shown on startup,
+						// a file that cant be read isnt overwritten.
+						file, _, err := loadConfig(p)
+						if err == nil {
+							err = file.set(c.Args()[0], c.Args()[1])
+						}
+						if err == nil {
+							err = saveConfig(p, file)
+						}
+						if err != nil {
+							printErr(err)
+						}
+					},
+				},
+			},
+		},
+		// aggregate
+		{
+			Name:      "aggregate",
+			ShortName: "agg",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "trackers, t",
+					Value: &cli.StringSlice{},
+				},
+				cli.StringFlag{
+					Name:  "period, p",
+					Value: cfg.get("aggregate.period", "w"),
+					Usage: periodUsage,
+				},
+				cli.IntFlag{
+					Name:  "frequency, f",
+					Value: cfg.getInt("frequency", 2),
+				},
+				cli.StringSliceFlag{
+					Name:  "categories, cat",
+					Value: &cli.StringSlice{},
+					Usage: "category ids or names",
+				},
+				cli.StringSliceFlag{
+					Name:  "tag",
+					Value: &cli.StringSlice{},
+					Usage: "aggregates the records carrying any of the tags",
+				},
+				cli.BoolFlag{
+					Name:  "graph, g",
+					Usage: "same as --output graph",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Value: cfg.get("output", "table"),
+					Usage: "table or graph",
+				},
+				cli.StringFlag{
+					Name:  "by, b",
+					Usage: "breaks the aggregates down by category or tracker",
+				},
+				cli.StringFlag{
+					Name:  "fn",
+					Value: cfg.get("fn", "sum"),
+					Usage: "sum, avg, min, max, count or median",
+				},
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "first day, defaults to frequency periods before --to",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "last day, defaults to today",
+				},
+			},
+			Action: func(c *cli.Context) {
+				var (
+					frequency  = c.Int("f")
+					categories = c.StringSlice("cat")
+					trackers   = c.StringSlice("t")
+				)
+
+				if frequency < 0 {
+					frequency = 0
+				}
+
+				period, err := parsePeriod(c.String("p"))
+				if err != nil {
+					printErr(err)
+					return
+				}
+
+				breakdown, ok := Dimensions[c.String("by")]
+				if !ok {
+					fmt.Println("invalid breakdown, expected category or tracker.")
+					return
+				}
+
+				fn, ok := Aggregations[c.String("fn")]
+				if !ok {
+					fmt.Println("invalid aggregation, expected sum, avg, min, max, count or median.")
+					return
+				}
+
+				from, err := dateFlag(c, "from")
+				if err != nil {
+					printErr(err)
+					return
+				}
+
+				to, err := dateFlag(c, "to")
+				if err != nil {
+					printErr(err)
+					return
+				}
+
+				if !from.IsZero() && !to.IsZero() && from.After(to) {
+					fmt.Println("--from is after --to.")
+					return
+				}
+
+				output := c.String("output")
+				if c.Bool("graph") {
+					output = "graph"
+				}
+				if output != "table" && output != "graph" {
+					fmt.Println("invalid output, expected table or graph.")
+					return
+				}
+
+				if breakdown != TOTAL && output == "graph" {
+					if c.IsSet("graph") || c.IsSet("output") {
+						fmt.Println("breakdowns cant be graphed.")
+						return
+					}
+					// the configured output doesnt apply to breakdowns
+					output = "table"
+				}
+
+				if len(trackers) == 0 {
+					trackers = append(trackers, DEFAULT_DB)
+				}
+
+				if len(trackers) == 1 && trackers[0] == "all" {
+					trackers, err = dblist()
+					if err != nil {
+						printErr(err)
+						return
+					}
+				}
+
+				fetcher := NewFetcher(frequency, period,
+					categories, trackers)
+				fetcher.Breakdown = breakdown
+				fetcher.Fn = fn
+				fetcher.From, fetcher.To = from, to
+				fetcher.Tags = c.StringSlice("tag")
+				if err := fetcher.Exec(); err != nil {
+					printErr(err)
+					return
+				}
+
+				for _, warning := range fetcher.Warnings() {
+					fmt.Println("WARNING:", warning)
+				}
+
+				goal, err := fetcher.Goal()
+				if err != nil {
+					printErr(err)
+					return
+				}
+
+				var component UIComponent
+				if output == "graph" {
+					g := graph.New(fetcher.PeriodKeys(), fetcher.Data(), noDataKeys(fetcher))
+					g.Format = fetcher.Format
+					if goal != nil {
+						g.SetGoal(float64(goal.target) / 100)
+					}
+					component = g
+				} else if breakdown != TOTAL {
+					component = breakdownTable(fetcher, trackers)
+				} else {
+					table := NewTable(2)
+					table.Format = fetcher.Format
+					table.Add(strings.Join(trackers, " & "), aggregateName(fetcher, strings.Join(fetcher.CatNames(), " & ")))
+
+					var mark func(float64) string
+					if goal != nil && fetcher.meta != nil {
+						table.Title = "goal " + goal.describe(*fetcher.meta)
+						mark = goal.mark
+					}
+
+					current := fetcher.CurrentKey()
+					for _, p := range fetcher.Points() {
+						table.Mark = mark
+						// the period in progress may still meet the goal
+						if mark != nil && p.Key == current {
+							table.Mark = goal.markCurrent
+						}
+						table.Add(p.Key, pointValue(fetcher, p))
+					}
+					// the total spans several periods of the goal
+					table.Mark = nil
+					table.Add("Total", fetcher.Total())
+
+					component = table
+				}
+				component.Print()
+			},
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
+}
+
+// breakdownTable returns a table with a column per breakdown series
+// followed by the total column.
+func breakdownTable(fetcher *Fetcher, trackers []string) *Table {
+	var (
+		series = fetcher.Series()
+		points = fetcher.Points()
+
+		table = NewTable(len(series) + 2)
+		row   = make([]interface{}, 0, len(series)+2)
+	)
+	table.Format = fetcher.Format
+
+	if fetcher.Breakdown == CATEGORY {
+		row = append(row, strings.Join(trackers, " & "))
+	} else {
+		row = append(row, strings.Join(fetcher.CatNames(), " & "))
+	}
+	for _, name := range series {
+		row = append(row, aggregateName(fetcher, name))
+	}
+	table.Add(append(row, aggregateName(fetcher, "Total"))...)
+
+	seriesPoints := make([][]Point, len(series))
+	for i, name := range series {
+		seriesPoints[i] = fetcher.SeriesPoints(name)
+	}
+
+	for i, p := range points {
+		row = append(row[:0], p.Key)
+		for j := range series {
+			row = append(row, pointValue(fetcher, seriesPoints[j][i]))
+		}
+		table.Add(append(row, pointValue(fetcher, p))...)
+	}
+
+	row = append(row[:0], "Total")
+	for _, name := range series {
+		row = append(row, fetcher.SeriesTotal(name))
+	}
+	table.Add(append(row, fetcher.Total())...)
+
+	return table
+}
+
+// aggregateName suffixes name with the aggregation
+// of the fetcher unless it sums quantities.
+func aggregateName(fetcher *Fetcher, name string) string {
+	if fetcher.Fn == SUM {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, fetcher.Fn)
+}
+
+// pointValue returns the value of p, periods without records
+// show no data unless the fetcher sums or counts quantities.
+func pointValue(fetcher *Fetcher, p Point) interface{} {
+	if isBlank(fetcher, p) {
+		return "-"
+	}
+	return p.Value
+}
+
+func isBlank(fetcher *Fetcher, p Point) bool {
+	return p.NoData && fetcher.Fn != SUM && fetcher.Fn != COUNT
+}
+
+// noDataKeys returns the keys of the periods without data that
+// pointValue leaves blank, graphs leave them out as well.
+func noDataKeys(fetcher *Fetcher) []string {
+	var keys []string
+	for _, p := range fetcher.Points() {
+		if isBlank(fetcher, p) {
+			keys = append(keys, p.Key)
+		}
+	}
+	return keys
+}
+
+// dateFlag parses the date of the flag name,
+// it returns the zero time when the flag isnt set.
+func dateFlag(c *cli.Context, name string) (time.Time, error) {
+	if s := c.String(name); s != "" {
+		return parseDate(s, time.Now())
+	}
+	return time.Time{}, nil
+}
+
+// recordID returns the record id given as first argument.
+func recordID(c *cli.Context) (int, error) {
+	id, err := strconv.Atoi(c.Args().First())
+	if err != nil {
+		return 0, ErrInvalidRecord
+	}
+	return id, nil
 }
 
 func printErr(err error) {
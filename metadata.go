@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxPrecision is the number of decimals quantities are stored with.
+const maxPrecision = 2
+
+type ErrInvalidQuantity struct {
+	value  string
+	reason string
+}
+
+func (err *ErrInvalidQuantity) Error() string {
+	return fmt.Sprintf("invalid quantity %q: %s.", err.value, err.reason)
+}
+
+type ErrMetadata struct {
+	key, value, expected string
+}
+
+func (err *ErrMetadata) Error() string {
+	return fmt.Sprintf("invalid %s %q, expected %s.", err.key, err.value, err.expected)
+}
+
+// Metadata describes what a tracker tracks, it is kept
+// in the metadata table of the tracker.
+type Metadata struct {
+	Unit        string
+	Description string
+	// Precision is the number of decimals of the quantities,
+	// -1 shows as many as needed.
+	Precision int
+	// Format lays out a quantity, {qty} is replaced by the
+	// quantity and {unit} by the unit.
+	Format string
+}
+
+// newMetadata returns the metadata of trackers without any,
+// quantities are shown as is.
+func newMetadata() Metadata {
+	return Metadata{Precision: -1}
+}
+
+var metadataKeys = []string{"unit", "description", "precision", "format"}
+
+// checkMetadata checks the key and value of a metadata,
+// empty values unset the metadata.
+func checkMetadata(key, value string) error {
+	switch key {
+	case "unit", "description":
+		return nil
+	case "precision":
+		if n, err := strconv.Atoi(value); value != "" && (err != nil || n < 0 || n > maxPrecision) {
+			return &ErrMetadata{key, value, fmt.Sprintf("a number of decimals from 0 to %d", maxPrecision)}
+		}
+		return nil
+	case "format":
+		if value != "" && !strings.Contains(value, "{qty}") {
+			return &ErrMetadata{key, value, "a layout with {qty} and optionally {unit}, as in {qty} {unit}"}
+		}
+		return nil
+	}
+	return &ErrMetadata{"metadata", key, strings.Join(metadataKeys, ", ")}
+}
+
+// format formats a quantity, v is in units rather than hundredths.
+func (m Metadata) format(v float64) string {
+	qty := strconv.FormatFloat(v, 'f', m.Precision, 64)
+
+	layout := m.Format
+	if layout == "" {
+		layout = "{qty}"
+		if m.Unit != "" {
+			layout = "{qty} {unit}"
+		}
+	}
+	return strings.Replace(strings.Replace(layout, "{qty}", qty, -1), "{unit}", m.Unit, -1)
+}
+
+// parseQuantity parses a quantity in hundredths, it may carry the
+// unit of the tracker and no more decimals than its precision.
+func (m Metadata) parseQuantity(s string) (int64, error) {
+	qty := strings.TrimSpace(s)
+	if m.Unit != "" {
+		lower, unit := strings.ToLower(qty), strings.ToLower(m.Unit)
+		if strings.HasSuffix(lower, unit) {
+			qty = strings.TrimSpace(qty[:len(qty)-len(unit)])
+		} else if strings.HasPrefix(lower, unit) {
+			qty = strings.TrimSpace(qty[len(unit):])
+		}
+	}
+
+	precision := m.Precision
+	if precision < 0 || precision > maxPrecision {
+		precision = maxPrecision
+	}
+
+	if i := strings.Index(qty, "."); i >= 0 && len(qty)-i-1 > precision {
+		return 0, &ErrInvalidQuantity{s, fmt.Sprintf("at most %d decimals", precision)}
+	}
+
+	v, err := strconv.ParseFloat(qty, 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		if m.Unit != "" {
+			return 0, &ErrInvalidQuantity{s, "expected a number, optionally in " + m.Unit}
+		}
+		return 0, &ErrInvalidQuantity{s, "expected a number"}
+	}
+	return int64(math.Round(v * 100)), nil
+}
+
+// getMetadata returns the metadata of the tracker.
+func (db *DB) getMetadata() (Metadata, error) {
+	var (
+		meta                   = newMetadata()
+		name, value, precision string
+	)
+
+	fields := map[string]*string{
+		"unit":        &meta.Unit,
+		"description": &meta.Description,
+		"precision":   &precision,
+		"format":      &meta.Format,
+	}
+
+	rows, err := db.Query("select name, value from metadata")
+	if err != nil {
+		return meta, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&name, &value); err != nil {
+			return meta, err
+		}
+		if field, ok := fields[name]; ok {
+			*field = value
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return meta, err
+	}
+
+	if precision != "" {
+		meta.Precision, err = strconv.Atoi(precision)
+	}
+	return meta, err
+}
+
+// setMetadata sets the metadata key, an empty value unsets it.
+func (db *DB) setMetadata(key, value string) error {
+	if err := checkMetadata(key, value); err != nil {
+		return err
+	}
+
+	if value == "" {
+		_, err := db.Exec("delete from metadata where name = ?", key)
+		return err
+	}
+
+	_, err := db.Exec("insert or replace into metadata(name, value) values(?, ?)", key, value)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuantity(t *testing.T) {
+	km := Metadata{Unit: "km", Precision: 1}
+
+	valid := map[string]int64{
+		"12":      1200,
+		"12.5":    1250,
+		"12.5km":  1250,
+		" 3 KM ":  300,
+		"-2.5 km": -250,
+		"0.3":     30,
+	}
+	for s, expected := range valid {
+		qty, err := km.parseQuantity(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, qty, s)
+	}
+
+	assert.Equal(t, &ErrInvalidQuantity{"12.25", "at most 1 decimals"}, errOf(km.parseQuantity("12.25")))
+	assert.Equal(t, &ErrInvalidQuantity{"12 EUR", "expected a number, optionally in km"}, errOf(km.parseQuantity("12 EUR")))
+	assert.Equal(t, &ErrInvalidQuantity{"", "expected a number"}, errOf(newMetadata().parseQuantity("")))
+
+	qty, err := Metadata{Unit: "EUR", Precision: -1}.parseQuantity("EUR 0.29")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(29), qty)
+}
+
+func errOf(_ int64, err error) error {
+	return err
+}
+
+func TestFormatQuantity(t *testing.T) {
+	assert.Equal(t, "3.8333", newMetadata().format(3.8333))
+	assert.Equal(t, "12.5 km", Metadata{Unit: "km", Precision: -1}.format(12.5))
+	assert.Equal(t, "12.50 km", Metadata{Unit: "km", Precision: 2}.format(12.5))
+	assert.Equal(t, "€13", Metadata{Unit: "€", Precision: 0, Format: "{unit}{qty}"}.format(12.6))
+	assert.Equal(t, "90 min", Metadata{Precision: -1, Format: "{qty} min"}.format(90))
+}
+
+func TestMetadata(t *testing.T) {
+	db := tempDB(t, "metadata")
+
+	meta, err := db.getMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, newMetadata(), meta)
+
+	assert.Equal(t, &ErrMetadata{"metadata", "colour", "unit, description, precision, format"}, db.setMetadata("colour", "red"))
+	assert.Equal(t, &ErrMetadata{"precision", "3", "a number of decimals from 0 to 2"}, db.setMetadata("precision", "3"))
+	assert.Equal(t, &ErrMetadata{"format", "{unit}", "a layout with {qty} and optionally {unit}, as in {qty} {unit}"},
+		db.setMetadata("format", "{unit}"))
+
+	assert.Nil(t, db.setMetadata("unit", "km"))
+	assert.Nil(t, db.setMetadata("description", "running"))
+	assert.Nil(t, db.setMetadata("precision", "1"))
+	assert.Nil(t, db.setMetadata("format", "{qty}{unit}"))
+
+	meta, err = db.getMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, Metadata{"km", "running", 1, "{qty}{unit}"}, meta)
+
+	assert.Nil(t, db.setMetadata("precision", ""))
+	meta, err = db.getMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, -1, meta.Precision)
+}
+
+func TestFetcherFormat(t *testing.T) {
+	fetcher := NewFetcher(0, DAY, []string{}, []string{})
+	assert.Equal(t, "12.5", fetcher.Format(12.5))
+
+	fetcher.addMetadata(Metadata{Unit: "km", Precision: 1})
+	assert.Equal(t, "12.5 km", fetcher.Format(12.5))
+
+	fetcher.Fn = COUNT
+	assert.Equal(t, "3", fetcher.Format(3))
+
+	fetcher.Fn = SUM
+	fetcher.addMetadata(Metadata{Unit: "EUR", Precision: 2})
+	assert.Equal(t, "12.5", fetcher.Format(12.5))
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type ErrSchemaVersion struct {
+	version int
+}
+
+func (err *ErrSchemaVersion) Error() string {
+	return fmt.Sprintf("tracker schema version %d is newer than supported version %d, upgrade tracker.",
+		err.version, schemaVersion())
+}
+
+type migration func(tx *sql.Tx) error
+
+// migrations upgrade a tracker schema one version at a time,
+// a tracker at version n went through the first n migrations.
+// Migrations must never be edited or reordered once released,
+// schema changes are appended as new migrations.
+var migrations = []migration{
+	// 1: categories and records
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			"CREATE TABLE IF NOT EXISTS categories(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name text NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS records(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, qty integer NOT NULL, "+
+				"date integer NOT NULL DEFAULT CURRENT_DATE, category integer NOT NULL DEFAULT 1)",
+			"INSERT INTO categories(name) SELECT 'default' WHERE NOT EXISTS (SELECT 1 FROM categories)")
+	},
+	// 2: unique category names, duplicates are merged into the oldest one
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			"UPDATE records SET category = (SELECT min(d.id) FROM categories c, categories d "+
+				"WHERE c.id = records.category AND lower(d.name) = lower(c.name)) "+
+				"WHERE category IN (SELECT c.id FROM categories c, categories d "+
+				"WHERE lower(d.name) = lower(c.name) AND d.id < c.id)",
+			"DELETE FROM categories WHERE EXISTS (SELECT 1 FROM categories d "+
+				"WHERE lower(d.name) = lower(categories.name) AND d.id < categories.id)",
+			"CREATE UNIQUE INDEX categories_name ON categories(name COLLATE NOCASE)")
+	},
+	// 3: utc timestamps and tracker settings. Dates with a time of
+	// day were written by add --date on the local wall clock. Dates
+	// without one, the CURRENT_DATE defaults of the first trackers
+	// included, are taken as local midnight so they keep their day,
+	// the time of the defaults being lost. Local is the default zone
+	// of the trackers, as they have no zone setting yet.
+	func(tx *sql.Tx) error {
+		if err := utcDates(tx); err != nil {
+			return err
+		}
+		return execAll(tx,
+			"CREATE TABLE settings(name text NOT NULL PRIMARY KEY, value text NOT NULL)")
+	},
+	// 4: metadata of the trackers, apart from their settings
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			"CREATE TABLE metadata(name text NOT NULL PRIMARY KEY, value text NOT NULL)")
+	},
+	// 5: notes and tags of records
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			"ALTER TABLE records ADD COLUMN note text NOT NULL DEFAULT ''",
+			"CREATE TABLE tags(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, name text NOT NULL)",
+			"CREATE UNIQUE INDEX tags_name ON tags(name COLLATE NOCASE)",
+			"CREATE TABLE record_tags(record integer NOT NULL, tag integer NOT NULL, PRIMARY KEY(record, tag))")
+	},
+	// 6: full-text index of the notes. It uses fts4 as fts5 is only
+	// built into go-sqlite3 with the sqlite_fts5 build tag.
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			"CREATE VIRTUAL TABLE notes USING fts4(content='records', note, tokenize=unicode61)",
+			"INSERT INTO notes(notes) VALUES('rebuild')",
+			"CREATE TRIGGER notes_insert AFTER INSERT ON records BEGIN "+
+				"INSERT INTO notes(docid, note) VALUES(new.id, new.note); END",
+			"CREATE TRIGGER notes_delete BEFORE DELETE ON records BEGIN "+
+				"DELETE FROM notes WHERE docid = old.id; END",
+			"CREATE TRIGGER notes_update_before BEFORE UPDATE OF note ON records BEGIN "+
+				"DELETE FROM notes WHERE docid = old.id; END",
+			"CREATE TRIGGER notes_update_after AFTER UPDATE OF note ON records BEGIN "+
+				"INSERT INTO notes(docid, note) VALUES(new.id, new.note); END")
+	},
+	// 7: goals and budgets, category 0 is the whole tracker
+	func(tx *sql.Tx) error {
+		return execAll(tx,
+			"CREATE TABLE goals(id integer NOT NULL PRIMARY KEY AUTOINCREMENT, category integer NOT NULL, "+
+				"period text NOT NULL, budget integer NOT NULL, target integer NOT NULL)",
+			"CREATE UNIQUE INDEX goals_category_period ON goals(category, period)")
+	},
+}
+
+// schemaVersion returns the schema version of the trackers
+// created by this binary.
+func schemaVersion() int {
+	return len(migrations)
+}
+
+func userVersion(db *sql.DB) (int, error) {
+	var version int
+
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// migrate applies the pending migrations of db, each in its
+// own transaction along with the version stamp.
+func migrate(db *sql.DB) error {
+	version, err := userVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version > schemaVersion() {
+		return &ErrSchemaVersion{version}
+	}
+
+	for ; version < schemaVersion(); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err = migrations[version](tx); err == nil {
+			// pragma values cant be bound
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// utcDates stores the dates of the records, read on the wall clock
+// of the default zone, in utc. Unreadable dates are left as is.
+func utcDates(tx *sql.Tx) error {
+	loc, err := defaultLocation()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, date FROM records")
+	if err != nil {
+		return err
+	}
+
+	var (
+		id    int
+		date  string
+		dates = make(map[int]string)
+	)
+	for rows.Next() {
+		if err = rows.Scan(&id, &date); err != nil {
+			rows.Close()
+			return err
+		}
+		dates[id] = date
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, date := range dates {
+		t, err := parseWallClock(date, loc)
+		if err != nil {
+			continue
+		}
+
+		if _, err = tx.Exec("UPDATE records SET date = ? WHERE id = ?", formatStoredDate(t), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, q := range queries {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
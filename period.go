@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const periodUsage = "h, d, w, m, q or y, or hour, day, week, month, quarter or year, " +
+	"optionally preceded by a number of units as in 14d"
+
+// Unit is the calendar unit periods are made of.
+type Unit int
+
+const (
+	HOURS Unit = iota
+	DAYS
+	WEEKS
+	MONTHS
+	QUARTERS
+	YEARS
+)
+
+// Period is a bucket of n units. Periods of more than one hour,
+// day or week are aligned on epoch, those of months, quarters and
+// years on year 0.
+type Period struct {
+	unit Unit
+	n    int
+}
+
+var (
+	HOUR    = Period{HOURS, 1}
+	DAY     = Period{DAYS, 1}
+	WEEK    = Period{WEEKS, 1}
+	MONTH   = Period{MONTHS, 1}
+	QUARTER = Period{QUARTERS, 1}
+	YEAR    = Period{YEARS, 1}
+)
+
+var Periods = map[string]Period{
+	"h":        HOUR,
+	"hour":     HOUR,
+	"hours":    HOUR,
+	"d":        DAY,
+	"day":      DAY,
+	"days":     DAY,
+	"w":        WEEK,
+	"week":     WEEK,
+	"weeks":    WEEK,
+	"m":        MONTH,
+	"month":    MONTH,
+	"months":   MONTH,
+	"q":        QUARTER,
+	"quarter":  QUARTER,
+	"quarters": QUARTER,
+	"y":        YEAR,
+	"year":     YEAR,
+	"years":    YEAR,
+}
+
+type ErrInvalidPeriod struct {
+	value string
+}
+
+func (err *ErrInvalidPeriod) Error() string {
+	return fmt.Sprintf("invalid period %q, expected %s.", err.value, periodUsage)
+}
+
+// epoch is the monday periods are aligned on, it is shared
+// with the sql of the period queries.
+var epoch = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// parsePeriod parses a period name, short or long, optionally
+// preceded by its number of units as in 14d or 2weeks.
+func parsePeriod(s string) (Period, error) {
+	var (
+		name = strings.ToLower(strings.TrimSpace(s))
+		i    = strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	)
+
+	if i < 0 {
+		return Period{}, &ErrInvalidPeriod{s}
+	}
+
+	period, ok := Periods[strings.TrimSpace(name[i:])]
+	if !ok {
+		return Period{}, &ErrInvalidPeriod{s}
+	}
+
+	if i > 0 {
+		n, err := strconv.Atoi(name[:i])
+		if err != nil || n <= 0 {
+			return Period{}, &ErrInvalidPeriod{s}
+		}
+		period.n = n
+	}
+	return period, nil
+}
+
+// String names the period the way parsePeriod reads
+// it back, as in month or 2 weeks.
+func (p Period) String() string {
+	names := [...]string{"hour", "day", "week", "month", "quarter", "year"}
+	if p.n == 1 {
+		return names[p.unit]
+	}
+	return fmt.Sprintf("%d %ss", p.n, names[p.unit])
+}
+
+// units returns the number of units in a period, quarters are
+// counted in months.
+func (p Period) units() int {
+	if p.unit == QUARTERS {
+		return 3 * p.n
+	}
+	return p.n
+}
+
+// daysSinceEpoch returns the number of calendar days
+// between epoch and the day of t.
+func daysSinceEpoch(t time.Time) int {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int(day.Sub(epoch).Hours() / 24)
+}
+
+// Calendar sets where weeks and years begin, the zero
+// Calendar has iso weeks and calendar years.
+type Calendar struct {
+	// weekShift is the number of days weeks begin before monday.
+	weekShift int
+	// yearShift is the number of months years begin after january.
+	yearShift int
+}
+
+type ErrInvalidCalendar struct {
+	value, expected string
+}
+
+func (err *ErrInvalidCalendar) Error() string {
+	return fmt.Sprintf("invalid calendar %q, expected %s.", err.value, err.expected)
+}
+
+// parseWeekStart parses the day weeks begin, monday or sunday.
+func parseWeekStart(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "monday", "mon":
+		return 0, nil
+	case "sunday", "sun":
+		return 1, nil
+	}
+	return 0, &ErrInvalidCalendar{s, "monday or sunday"}
+}
+
+// parseYearStart parses the month years begin, by name or number.
+func parseYearStart(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= 12 {
+		return n - 1, nil
+	}
+
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		if s == name || (len(s) == 3 && s == name[:3]) {
+			return int(m - time.January), nil
+		}
+	}
+	return 0, &ErrInvalidCalendar{s, "a month like april or 4"}
+}
+
+func (c Calendar) WeekStart() time.Weekday {
+	return (time.Monday - time.Weekday(c.weekShift) + 7) % 7
+}
+
+func (c Calendar) YearStart() time.Month {
+	return time.January + time.Month(c.yearShift)
+}
+
+func (c Calendar) String() string {
+	return fmt.Sprintf("weeks begin on %s, years begin in %s", c.WeekStart(), c.YearStart())
+}
+
+// year returns the year t belongs to, fiscal years are
+// numbered after the calendar year they begin in.
+func (c Calendar) year(t time.Time) int {
+	if t.Month() < c.YearStart() {
+		return t.Year() - 1
+	}
+	return t.Year()
+}
+
+func (c Calendar) yearName(year int) string {
+	if c.yearShift == 0 {
+		return strconv.Itoa(year)
+	}
+	return fmt.Sprintf("FY%d/%02d", year, (year+1)%100)
+}
+
+// week returns the year and number of the week beginning at start,
+// monday weeks are iso weeks and the first week of other calendars
+// is the one of january 1st.
+func (c Calendar) week(start time.Time) (int, int) {
+	if c.weekShift == 0 {
+		return start.ISOWeek()
+	}
+
+	year := start.AddDate(0, 0, 6).Year()
+	first := daysSinceEpoch(time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)) + c.weekShift
+	first -= first % 7
+
+	return year, (daysSinceEpoch(start)+c.weekShift-first)/7 + 1
+}
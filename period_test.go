@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeriod(t *testing.T) {
+	valid := map[string]Period{
+		"h":        HOUR,
+		"d":        DAY,
+		"w":        WEEK,
+		"m":        MONTH,
+		"q":        QUARTER,
+		"y":        YEAR,
+		"6h":       Period{HOURS, 6},
+		"14d":      Period{DAYS, 14},
+		"2w":       Period{WEEKS, 2},
+		"1m":       MONTH,
+		"day":      DAY,
+		"Weeks":    WEEK,
+		"quarter":  QUARTER,
+		"2weeks":   Period{WEEKS, 2},
+		"3 months": Period{MONTHS, 3},
+		" hour ":   HOUR,
+	}
+	for s, expected := range valid {
+		period, err := parsePeriod(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, period, s)
+	}
+
+	for _, s := range []string{"", "x", "0d", "-2d", "2", "d2", "fortnight", "2 w d"} {
+		_, err := parsePeriod(s)
+		assert.Equal(t, &ErrInvalidPeriod{s}, err, s)
+	}
+}
+
+func TestPeriodUnits(t *testing.T) {
+	assert.Equal(t, 1, DAY.units())
+	assert.Equal(t, 3, QUARTER.units())
+	assert.Equal(t, 6, Period{QUARTERS, 2}.units())
+}
+
+func TestParseCalendar(t *testing.T) {
+	for s, shift := range map[string]int{"monday": 0, "Mon": 0, "sunday": 1, "SUN": 1} {
+		n, err := parseWeekStart(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, shift, n, s)
+	}
+	_, err := parseWeekStart("friday")
+	assert.Equal(t, &ErrInvalidCalendar{"friday", "monday or sunday"}, err)
+
+	for s, shift := range map[string]int{"january": 0, "April": 3, "apr": 3, "4": 3, "12": 11} {
+		n, err := parseYearStart(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, shift, n, s)
+	}
+	for _, s := range []string{"", "13", "0", "ap", "fiscal"} {
+		_, err := parseYearStart(s)
+		_, ok := err.(*ErrInvalidCalendar)
+		assert.True(t, ok, s)
+	}
+
+	assert.Equal(t, "weeks begin on Monday, years begin in January", Calendar{}.String())
+	assert.Equal(t, "weeks begin on Sunday, years begin in April", Calendar{1, 3}.String())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+)
+
+// query builds a select statement whose values are bound
+// as arguments instead of being spliced into the sql.
+type query struct {
+	table   string
+	columns []string
+	conds   []string
+	args    []interface{}
+	groups  []string
+	orderBy string
+	limit   int
+}
+
+func newQuery(table string, columns ...string) *query {
+	return &query{
+		table:   table,
+		columns: columns,
+		conds:   make([]string, 0),
+		args:    make([]interface{}, 0),
+	}
+}
+
+// where adds a condition, the placeholders of cond
+// are bound to args in order.
+func (q *query) where(cond string, args ...interface{}) *query {
+	q.conds = append(q.conds, cond)
+	q.args = append(q.args, args...)
+	return q
+}
+
+// in restricts column to values, it is a noop when values is empty.
+func (q *query) in(column string, values []int) *query {
+	if len(values) == 0 {
+		return q
+	}
+
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return q.where(column+" in ("+placeholders(len(values))+")", args...)
+}
+
+func (q *query) group(exprs ...string) *query {
+	q.groups = append(q.groups, exprs...)
+	return q
+}
+
+func (q *query) order(expr string) *query {
+	q.orderBy = expr
+	return q
+}
+
+func (q *query) max(n int) *query {
+	q.limit = n
+	return q
+}
+
+func (q *query) String() string {
+	s := "select " + strings.Join(q.columns, ", ") + " from " + q.table
+
+	if len(q.conds) > 0 {
+		s += " where (" + strings.Join(q.conds, ") and (") + ")"
+	}
+	if len(q.groups) > 0 {
+		s += " group by " + strings.Join(q.groups, ", ")
+	}
+	if len(q.orderBy) > 0 {
+		s += " order by " + q.orderBy
+	}
+	if q.limit > 0 {
+		s += " limit " + itoa(q.limit)
+	}
+	return s
+}
+
+func (q *query) Args() []interface{} {
+	return q.args
+}
+
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
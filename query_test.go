@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryString(t *testing.T) {
+	qry := newQuery("records", "records.qty", "records.date")
+	assert.Equal(t, "select records.qty, records.date from records", qry.String())
+	assert.Equal(t, 0, len(qry.Args()))
+
+	qry.where("records.date >= ?", "2015-01-01").
+		in("records.category", []int{1, 2, 3}).
+		group("records.date").
+		order("records.date desc").
+		max(5)
+	assert.Equal(t, "select records.qty, records.date from records "+
+		"where (records.date >= ?) and (records.category in (?, ?, ?)) "+
+		"group by records.date order by records.date desc limit 5", qry.String())
+	assert.Equal(t, []interface{}{"2015-01-01", 1, 2, 3}, qry.Args())
+}
+
+func TestQueryInEmpty(t *testing.T) {
+	qry := newQuery("records", "records.qty").in("records.category", []int{})
+	assert.Equal(t, "select records.qty from records", qry.String())
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var ErrNoQuery = errors.New("search query required.")
+
+// match is a record found by a search along with its tracker.
+type match struct {
+	tracker string
+	meta    Metadata
+	record
+}
+
+type byDate []match
+
+func (s byDate) Len() int           { return len(s) }
+func (s byDate) Less(i, j int) bool { return s[i].date.After(s[j].date) }
+func (s byDate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ftsQuery turns the words of s into a query of the notes index
+// matching the notes that contain all of them, words ending with *
+// match prefixes.
+func ftsQuery(s string) string {
+	words := strings.Fields(strings.Replace(s, `"`, " ", -1))
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " ")
+}
+
+// searchRecords returns the latest records whose note matches
+// the words of q. limit <= 0 returns every match.
+func (db *DB) searchRecords(q string, limit int) ([]record, error) {
+	match := ftsQuery(q)
+	if match == "" {
+		return nil, ErrNoQuery
+	}
+
+	qry := db.recordsQuery().
+		where("records.id in (select docid from notes where notes match ?)", match).
+		order("records.date desc, records.id desc").
+		max(limit)
+	return db.scanRecords(qry)
+}
+
+// search returns the latest records of trackers whose note
+// matches the words of q, limit <= 0 returns every match.
+func search(trackers []string, q string, limit int) ([]match, error) {
+	var res []match
+
+	for _, tracker := range trackers {
+		err := withDBContext(tracker, func(db *DB) error {
+			meta, err := db.getMetadata()
+			if err != nil {
+				return err
+			}
+
+			records, err := db.searchRecords(q, limit)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range records {
+				res = append(res, match{tracker, meta, r})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Stable(byDate(res))
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFtsQuery(t *testing.T) {
+	assert.Equal(t, `"paid" "plumber"`, ftsQuery("  paid plumber "))
+	assert.Equal(t, `"plumb*"`, ftsQuery("plumb*"))
+	assert.Equal(t, `"say" "hi"`, ftsQuery(`say "hi"`))
+	assert.Equal(t, "", ftsQuery(`" "`))
+}
+
+func TestSearch(t *testing.T) {
+	db := tempDB(t, "search")
+
+	day := time.Date(2015, time.March, 1, 0, 0, 0, 0, time.Local)
+	_, err := db.insertRecord(record{qty: 8000, category: 1, date: day, note: "paid the plumber"})
+	assert.Nil(t, err)
+
+	_, err = db.searchRecords(" ", 0)
+	assert.Equal(t, ErrNoQuery, err)
+
+	_, err = db.searchRecords(`"`, 0)
+	assert.Equal(t, ErrNoQuery, err)
+
+	records, err := db.searchRecords("plumber", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+
+	id, err := db.insertRecord(record{qty: 4500, category: 1, date: day.AddDate(0, 1, 0), note: "Plumber again, kitchen sink"})
+	assert.Nil(t, err)
+	assert.Nil(t, db.addRecord(100, 1, day))
+
+	records, err = db.searchRecords("PLUMB*", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, id, records[0].id)
+
+	records, err = db.searchRecords("plumber sink", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+
+	assert.Nil(t, db.deleteRecord(id))
+	records, err = db.searchRecords("plumber", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "paid the plumber", records[0].note)
+}
+
+func TestSearchTrackers(t *testing.T) {
+	var id int
+	err := withDBContext("testf", func(db *DB) (err error) {
+		id, err = db.insertRecord(record{qty: 300, category: 1, date: time.Now(), note: "bus ticket"})
+		return err
+	})
+	assert.Nil(t, err)
+	defer withDBContext("testf", func(db *DB) error { return db.deleteRecord(id) })
+
+	matches, err := search([]string{"test", "testf"}, "ticket", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(matches))
+	assert.Equal(t, "testf", matches[0].tracker)
+	assert.Equal(t, int64(300), matches[0].qty)
+
+	_, err = search([]string{"test", "nope"}, "ticket", 10)
+	assert.Equal(t, &ErrInvalidDB{"nope"}, err)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"time"
+)
+
+// habit sums up how regularly the records of a category
+// are added, period by period.
+type habit struct {
+	catname string
+	period  Period
+	goal    *Goal
+
+	entries     int
+	first, last time.Time
+	// periods is the number of periods from the first record to now.
+	periods int
+	// current is the streak of periods ending now, the current
+	// period is left out while it isnt completed.
+	current int
+	longest int
+}
+
+// frequency returns the average number of records per period.
+func (h habit) frequency() float64 {
+	if h.periods == 0 {
+		return 0
+	}
+	return float64(h.entries) / float64(h.periods)
+}
+
+// daysSince returns the number of days from the last record to now.
+func (h habit) daysSince(now time.Time) int {
+	return daysSinceEpoch(now.In(h.last.Location())) - daysSinceEpoch(h.last)
+}
+
+// span names n periods of p, as in 1 day or 3 weeks.
+func span(p Period, n int) string {
+	s := Period{p.unit, n * p.n}.String()
+	if n*p.n == 1 {
+		return "1 " + s
+	}
+	return s
+}
+
+// habitStats computes the streaks of category up to now, periods
+// count when they hold a record or meet the goal of the category.
+// Records dated after now are left out.
+func (db *DB) habitStats(category int, period Period, now time.Time) (habit, error) {
+	h := habit{period: period}
+
+	var err error
+	if h.catname, err = db.getCategory(category); err != nil {
+		return h, err
+	}
+
+	records, err := db.getRecords([]int{category}, nil, 0)
+	if err != nil {
+		return h, err
+	}
+
+	now = now.In(db.loc)
+	for len(records) > 0 && records[0].date.After(now) {
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		return h, nil
+	}
+	h.entries = len(records)
+	h.last, h.first = records[0].date, records[len(records)-1].date
+
+	if h.goal, err = db.goalOf([]int{category}, period); err != nil {
+		return h, err
+	}
+
+	datas, err := db.queryPeriod(period, h.first, now, []int{category}, nil)
+	if err != nil {
+		return h, err
+	}
+
+	sums := make(map[string]float64, len(datas))
+	for _, data := range datas {
+		sums[data.Key()] += float64(data.Quantity()) / 100
+	}
+
+	var (
+		data  = timeData{date: now, period: period, cal: db.cal}
+		first = timeData{date: h.first, period: period, cal: db.cal}.Start()
+		run   int
+		ended bool
+	)
+	data.date = data.Start()
+
+	for i := 0; !data.date.Before(first); i++ {
+		sum, ok := sums[data.Key()]
+		if h.goal != nil {
+			ok = h.goal.reached(sum)
+		}
+
+		if ok {
+			run++
+		} else {
+			// the current period may still be completed
+			ended = ended || i > 0
+			run = 0
+		}
+
+		if !ended {
+			h.current = run
+		}
+		if run > h.longest {
+			h.longest = run
+		}
+
+		h.periods++
+		data = data.Prev()
+		data.date = data.Start()
+	}
+	return h, nil
+}
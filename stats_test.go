@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpan(t *testing.T) {
+	assert.Equal(t, "0 days", span(DAY, 0))
+	assert.Equal(t, "1 day", span(DAY, 1))
+	assert.Equal(t, "3 weeks", span(WEEK, 3))
+	assert.Equal(t, "4 weeks", span(Period{WEEKS, 2}, 2))
+}
+
+func TestHabitStats(t *testing.T) {
+	db := tempDB(t, "stats")
+
+	assert.Nil(t, db.addCategories("run"))
+
+	var (
+		now = time.Date(2015, time.March, 20, 18, 0, 0, 0, db.loc)
+		day = func(d int) time.Time { return time.Date(2015, time.March, d, 8, 0, 0, 0, db.loc) }
+	)
+
+	h, err := db.habitStats(2, DAY, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "run", h.catname)
+	assert.Equal(t, 0, h.entries)
+
+	// a streak of 4 days, then 3 days up to yesterday and
+	// a record ahead of now
+	for _, d := range []int{10, 11, 12, 13, 17, 18, 18, 19, 25} {
+		assert.Nil(t, db.addRecord(100, 2, day(d)))
+	}
+
+	h, err = db.habitStats(2, DAY, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, h.entries)
+	assert.Equal(t, 3, h.current)
+	assert.Equal(t, 4, h.longest)
+	assert.Equal(t, 11, h.periods)
+	assert.Equal(t, 1, h.daysSince(now))
+	assert.InDelta(t, 0.727, h.frequency(), 0.001)
+
+	// the streak ends once a whole period goes by without record
+	h, err = db.habitStats(2, DAY, now.AddDate(0, 0, 1))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, h.current)
+
+	h, err = db.habitStats(2, WEEK, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, h.current)
+	assert.Equal(t, 2, h.longest)
+
+	// with a goal, periods count when they meet it
+	assert.Nil(t, db.setGoal(2, DAY, false, 200))
+	h, err = db.habitStats(2, DAY, now)
+	assert.Nil(t, err)
+	assert.NotNil(t, h.goal)
+	assert.Equal(t, 0, h.current)
+	assert.Equal(t, 1, h.longest)
+
+	_, err = db.habitStats(42, DAY, now)
+	assert.Equal(t, ErrInvalidCategory, err)
+}
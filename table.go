@@ -4,11 +4,18 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 type Table struct {
 	CellPadding int
 	Title       string
+	// Format formats the float cells added after it is set.
+	Format func(float64) string
+	// Mark returns the marker following the float cells added
+	// after it is set, as whether they meet a goal. Cells are
+	// left unmarked when it is empty.
+	Mark func(float64) string
 
 	rows    [][]string
 	columns []*column
@@ -86,8 +93,16 @@ func (t *Table) Add(row ...interface{}) {
 	r := make([]string, lencols)
 	for i := 0; i < lenrow; i++ {
 		val := fmt.Sprintf("%v", row[i])
+		if f, ok := row[i].(float64); ok && t.Format != nil {
+			val = t.Format(f)
+		}
+		if f, ok := row[i].(float64); ok && t.Mark != nil {
+			if mark := t.Mark(f); mark != "" {
+				val += " " + mark
+			}
+		}
 
-		if width := len(val); width > t.columns[i].width {
+		if width := utf8.RuneCountInString(val); width > t.columns[i].width {
 			t.columns[i].width = width
 		}
 		r[i] = val
@@ -103,7 +118,7 @@ func (t *Table) SetColumn(index int, value string) {
 	col := t.columns[index]
 
 	col.name = value
-	if width := len(value); width > col.width {
+	if width := utf8.RuneCountInString(value); width > col.width {
 		col.width = width
 	}
 }
@@ -128,7 +143,7 @@ func (t *Table) adjustTitleDiff() {
 	var (
 		contentWidth int
 
-		titleWidth = len(t.Title)
+		titleWidth = utf8.RuneCountInString(t.Title)
 		colNb      = len(t.columns)
 	)
 
@@ -187,7 +202,7 @@ func (t *Table) printRow(row []string) {
 		b.WriteString(strings.Repeat(" ", t.CellPadding))
 		b.WriteString(field)
 
-		if diff := t.columns[i].width - len(field); diff > 0 {
+		if diff := t.columns[i].width - utf8.RuneCountInString(field); diff > 0 {
 			b.WriteString(strings.Repeat(" ", diff))
 		}
 
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type ErrInvalidTag struct {
+	name string
+}
+
+func (err *ErrInvalidTag) Error() string {
+	return fmt.Sprintf("invalid tag %q, tags cant be empty or contain commas.", err.name)
+}
+
+type ErrUnknownTag struct {
+	name string
+}
+
+func (err *ErrUnknownTag) Error() string {
+	return fmt.Sprintf("tag %q doesnt exist.", err.name)
+}
+
+// tag counts the records of a tag.
+type tag struct {
+	id      int
+	name    string
+	records int
+}
+
+func checkTag(name string) error {
+	if strings.TrimSpace(name) == "" || strings.Contains(name, ",") {
+		return &ErrInvalidTag{name}
+	}
+	return nil
+}
+
+// tagRecord links the record id to tags, creating the tags
+// that dont exist yet. Tags are matched regardless of case.
+func tagRecord(tx *sql.Tx, id int, tags []string) error {
+	for _, name := range tags {
+		name = strings.TrimSpace(name)
+
+		if _, err := tx.Exec("insert or ignore into tags(name) values(?)", name); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec("insert or ignore into record_tags(record, tag) "+
+			"select ?, id from tags where name = ? collate nocase", id, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagged restricts qry to the records carrying any of tags,
+// it is a noop when tags is empty.
+func tagged(qry *query, tags []int) *query {
+	if len(tags) == 0 {
+		return qry
+	}
+
+	args := make([]interface{}, len(tags))
+	for i, id := range tags {
+		args[i] = id
+	}
+	return qry.where("records.id in (select record from record_tags where tag in ("+
+		placeholders(len(tags))+"))", args...)
+}
+
+// resolveTags returns the ids of the tags named names,
+// regardless of case, and the names that dont exist.
+func (db *DB) resolveTags(names []string) ([]int, []string, error) {
+	var (
+		ids     []int
+		missing []string
+	)
+
+	for _, name := range names {
+		var id int
+
+		qry := newQuery("tags", "id").where("name = ? collate nocase", strings.TrimSpace(name))
+
+		err := db.QueryRow(qry.String(), qry.Args()...).Scan(&id)
+		if err == sql.ErrNoRows {
+			missing = append(missing, name)
+			continue
+		} else if err != nil {
+			return ids, missing, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, missing, nil
+}
+
+// getTags returns the tags of the tracker by name.
+func (db *DB) getTags() ([]tag, error) {
+	var (
+		t   tag
+		res []tag
+	)
+
+	qry := newQuery("tags left join record_tags on record_tags.tag = tags.id",
+		"tags.id", "tags.name", "count(record_tags.record)").
+		group("tags.id").
+		order("tags.name collate nocase")
+
+	rows, err := db.Query(qry.String(), qry.Args()...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&t.id, &t.name, &t.records); err != nil {
+			return res, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTags(t *testing.T) {
+	db := tempDB(t, "tags")
+
+	now := time.Now()
+	_, err := db.insertRecord(record{qty: 100, category: 1, date: now, tags: []string{"a,b"}})
+	assert.Equal(t, &ErrInvalidTag{"a,b"}, err)
+
+	first, err := db.insertRecord(record{qty: 100, category: 1, date: now,
+		note: "train to Lyon", tags: []string{"work", "travel"}})
+	assert.Nil(t, err)
+
+	_, err = db.insertRecord(record{qty: 250, category: 1, date: now, tags: []string{"Work"}})
+	assert.Nil(t, err)
+	assert.Nil(t, db.addRecord(400, 1, now))
+
+	r, err := db.getRecord(first)
+	assert.Nil(t, err)
+	assert.Equal(t, "train to Lyon", r.note)
+	assert.Equal(t, []string{"travel", "work"}, r.tags)
+
+	tags, missing, err := db.resolveTags([]string{"WORK", "gym"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tags))
+	assert.Equal(t, []string{"gym"}, missing)
+
+	records, err := db.getRecords([]int{}, tags, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+
+	datas, err := db.queryPeriod(DAY, now, now, []int{}, tags)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(datas))
+	assert.Equal(t, 350, datas[0].Quantity())
+
+	all, err := db.getTags()
+	assert.Nil(t, err)
+	assert.Equal(t, []tag{{2, "travel", 1}, {1, "work", 2}}, all)
+
+	assert.Nil(t, db.deleteRecord(first))
+	all, err = db.getTags()
+	assert.Nil(t, err)
+	assert.Equal(t, []tag{{2, "travel", 0}, {1, "work", 1}}, all)
+}
+
+func TestExecTags(t *testing.T) {
+	var id int
+	err := withDBContext("testf", func(db *DB) (err error) {
+		id, err = db.insertRecord(record{qty: 300, category: 1, date: time.Now(), tags: []string{"work"}})
+		return err
+	})
+	assert.Nil(t, err)
+	defer withDBContext("testf", func(db *DB) error { return db.deleteRecord(id) })
+
+	fetcher := NewFetcher(0, WEEK, []string{}, []string{"test", "testf"})
+	fetcher.Tags = []string{"WORK", "gym"}
+
+	assert.Nil(t, fetcher.Exec())
+	assert.Equal(t, 3.0, fetcher.Total())
+	assert.Equal(t, 3, len(fetcher.Warnings()))
+	assert.Contains(t, fetcher.Warnings(), `tracker testf has no tag "gym", skipped.`)
+}